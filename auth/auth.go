@@ -0,0 +1,171 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/toversus/tbdist/model"
+)
+
+var (
+	// ErrMissingCredentials is returned when a request carries neither an API key nor a token
+	ErrMissingCredentials = errors.New("Credentials are missing")
+	// ErrInvalidCredentials is returned when the API key is unknown or the token is malformed or forged
+	ErrInvalidCredentials = errors.New("Credentials are invalid")
+	// ErrExpired is returned when the token has expired or is not valid yet
+	ErrExpired = errors.New("Token has expired")
+)
+
+// Principal is the authenticated caller of a request
+type Principal struct {
+	Subject string `json:"subject"`
+	Tenant  string `json:"tenant,omitempty"` // empty when the caller belongs to no tenant
+}
+
+type principalKey struct{}
+
+// WithPrincipal returns a copy of the context carrying the principal
+func WithPrincipal(ctx context.Context, p Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// FromContext returns the principal carried by the context, false when
+// the request was not authenticated
+func FromContext(ctx context.Context) (Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(Principal)
+	return p, ok
+}
+
+// Key is a static API key and the principal it authenticates
+type Key struct {
+	Key string `json:"key"`
+	Principal
+}
+
+// LoadKeys reads a JSON file listing the API keys such as
+// [{"key": "secret", "subject": "alice", "tenant": "team-a"}]
+func LoadKeys(path string) ([]Key, error) {
+	j, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []Key
+	if err := json.Unmarshal(j, &keys); err != nil {
+		return nil, fmt.Errorf("keys %s: %v", path, err)
+	}
+
+	seen := make(map[string]bool)
+	for i, k := range keys {
+		if k.Key == "" || k.Subject == "" {
+			return nil, fmt.Errorf("keys %s: key %d needs a key and a subject", path, i)
+		}
+		if k.Tenant != "" && !model.ValidProjectID(k.Tenant) {
+			return nil, fmt.Errorf("keys %s: invalid tenant ID %q", path, k.Tenant)
+		}
+		if seen[k.Key] {
+			return nil, fmt.Errorf("keys %s: the key of %s is not unique", path, k.Subject)
+		}
+		seen[k.Key] = true
+	}
+	return keys, nil
+}
+
+// LoadSecret reads the secret signing the tokens from a file, the
+// surrounding white space is ignored
+func LoadSecret(path string) ([]byte, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	secret := []byte(strings.TrimSpace(string(b)))
+	if len(secret) < minSecretLen {
+		return nil, fmt.Errorf("secret %s: at least %d bytes are required", path, minSecretLen)
+	}
+	return secret, nil
+}
+
+// Authenticator identifies the caller of a request from its API key
+// or its signed token
+type Authenticator struct {
+	keys   map[[sha256.Size]byte]Principal // keys maps the hashes of the API keys to their principal
+	secret []byte                          // secret is nil when tokens are not accepted
+	now    func() time.Time
+}
+
+// Option configures an Authenticator
+type Option func(*Authenticator)
+
+// WithClock sets the function the expiry of the tokens is checked against
+func WithClock(now func() time.Time) Option {
+	return func(a *Authenticator) {
+		a.now = now
+	}
+}
+
+// New returns an authenticator accepting the API keys and the tokens
+// signed with the secret. Only the hashes of the keys are kept
+func New(keys []Key, secret []byte, opts ...Option) *Authenticator {
+	a := &Authenticator{
+		keys:   make(map[[sha256.Size]byte]Principal),
+		secret: secret,
+		now:    time.Now,
+	}
+	for _, k := range keys {
+		a.keys[sha256.Sum256([]byte(k.Key))] = k.Principal
+	}
+	for _, opt := range opts {
+		opt(a)
+	}
+	return a
+}
+
+// Authenticate returns the principal of the request. The credentials are
+// read from the X-API-Key header or the bearer token of the Authorization
+// header, which is either an API key or a signed token
+func (a *Authenticator) Authenticate(r *http.Request) (Principal, error) {
+	if key := r.Header.Get("X-API-Key"); key != "" {
+		return a.key(key)
+	}
+
+	header := r.Header.Get("Authorization")
+	if header == "" {
+		return Principal{}, ErrMissingCredentials
+	}
+	token, ok := strings.CutPrefix(header, "Bearer ")
+	if !ok || token == "" {
+		return Principal{}, ErrInvalidCredentials
+	}
+	if strings.Count(token, ".") == 2 {
+		return a.token(token)
+	}
+	return a.key(token)
+}
+
+func (a *Authenticator) key(key string) (Principal, error) {
+	p, ok := a.keys[sha256.Sum256([]byte(key))]
+	if !ok {
+		return Principal{}, ErrInvalidCredentials
+	}
+	return p, nil
+}
+
+func (a *Authenticator) token(token string) (Principal, error) {
+	if a.secret == nil {
+		return Principal{}, ErrInvalidCredentials
+	}
+
+	c, err := Verify(token, a.secret, a.now())
+	if err != nil {
+		return Principal{}, err
+	}
+	return Principal{Subject: c.Subject, Tenant: c.Tenant}, nil
+}
@@ -0,0 +1,213 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+var (
+	now    = time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC)
+	secret = []byte("0123456789abcdef0123456789abcdef")
+	keys   = []Key{
+		{Key: "key-alice", Principal: Principal{Subject: "alice", Tenant: "team-a"}},
+		{Key: "key-bob", Principal: Principal{Subject: "bob"}},
+	}
+)
+
+// token signs the claims with the test secret
+func token(t *testing.T, c Claims) string {
+	s, err := Sign(c, secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestAuthenticate(t *testing.T) {
+	t.Log("authenticating requests...")
+
+	valid := token(t, Claims{Subject: "carol", Tenant: "team-b", ExpiresAt: now.Add(time.Hour).Unix()})
+	parts := strings.Split(valid, ".")
+
+	var authenticateTests = []struct {
+		name   string
+		header string
+		value  string
+		expect Principal
+		err    error
+	}{
+		{
+			name:   "should authenticate an API key from the X-API-Key header",
+			header: "X-API-Key",
+			value:  "key-alice",
+			expect: Principal{Subject: "alice", Tenant: "team-a"},
+		},
+		{
+			name:   "should authenticate an API key from the bearer token",
+			header: "Authorization",
+			value:  "Bearer key-bob",
+			expect: Principal{Subject: "bob"},
+		},
+		{
+			name:   "should authenticate a signed token",
+			header: "Authorization",
+			value:  "Bearer " + valid,
+			expect: Principal{Subject: "carol", Tenant: "team-b"},
+		},
+		{
+			name: "should reject a request without credentials",
+			err:  ErrMissingCredentials,
+		},
+		{
+			name:   "should reject an unknown API key",
+			header: "X-API-Key",
+			value:  "key-mallory",
+			err:    ErrInvalidCredentials,
+		},
+		{
+			name:   "should reject an authorization which is not a bearer token",
+			header: "Authorization",
+			value:  "Basic a2V5LWJvYg==",
+			err:    ErrInvalidCredentials,
+		},
+		{
+			name:   "should reject an expired token",
+			header: "Authorization",
+			value:  "Bearer " + token(t, Claims{Subject: "carol", ExpiresAt: now.Unix()}),
+			err:    ErrExpired,
+		},
+		{
+			name:   "should reject a token not valid yet",
+			header: "Authorization",
+			value:  "Bearer " + token(t, Claims{Subject: "carol", ExpiresAt: now.Add(2 * time.Hour).Unix(), NotBefore: now.Add(time.Hour).Unix()}),
+			err:    ErrExpired,
+		},
+		{
+			name:   "should reject a token without expiry",
+			header: "Authorization",
+			value:  "Bearer " + token(t, Claims{Subject: "carol"}),
+			err:    ErrInvalidCredentials,
+		},
+		{
+			name:   "should reject a signed token with an invalid tenant",
+			header: "Authorization",
+			value:  "Bearer " + token(t, Claims{Subject: "carol", Tenant: "../team-a", ExpiresAt: now.Add(time.Hour).Unix()}),
+			err:    ErrInvalidCredentials,
+		},
+		{
+			name:   "should reject a token whose claims were changed",
+			header: "Authorization",
+			value:  "Bearer " + parts[0] + "." + encode([]byte(`{"sub":"carol","tenant":"team-a","exp":9999999999}`)) + "." + parts[2],
+			err:    ErrInvalidCredentials,
+		},
+		{
+			name:   "should reject a token signed with another secret",
+			header: "Authorization",
+			value:  "Bearer " + parts[0] + "." + parts[1] + "." + encode(sign(parts[0]+"."+parts[1], []byte("another secret"))),
+			err:    ErrInvalidCredentials,
+		},
+		{
+			name:   "should reject an unsigned token",
+			header: "Authorization",
+			value:  "Bearer " + encode([]byte(`{"alg":"none"}`)) + "." + parts[1] + ".",
+			err:    ErrInvalidCredentials,
+		},
+	}
+
+	a := New(keys, secret, WithClock(func() time.Time { return now }))
+	for _, testcase := range authenticateTests {
+		t.Log(testcase.name)
+
+		req, _ := http.NewRequest(http.MethodGet, "/tasks", nil)
+		if testcase.header != "" {
+			req.Header.Set(testcase.header, testcase.value)
+		}
+
+		p, err := a.Authenticate(req)
+		if !errors.Is(err, testcase.err) {
+			t.Errorf("=> Got %v expected %v", err, testcase.err)
+		}
+		if p != testcase.expect {
+			t.Errorf("=> Got %v expected %v", p, testcase.expect)
+		}
+	}
+}
+
+func TestTokensDisabled(t *testing.T) {
+	t.Log("authenticating without secret...")
+
+	req, _ := http.NewRequest(http.MethodGet, "/tasks", nil)
+	req.Header.Set("Authorization", "Bearer "+token(t, Claims{Subject: "carol", ExpiresAt: time.Now().Add(time.Hour).Unix()}))
+
+	if _, err := New(keys, nil).Authenticate(req); err != ErrInvalidCredentials {
+		t.Errorf("=> Got %v expected %v", err, ErrInvalidCredentials)
+	}
+}
+
+var loadKeysTests = []struct {
+	name   string
+	file   string
+	expect []Key
+	err    bool
+}{
+	{
+		name:   "should load the keys and their principal",
+		file:   `[{"key":"key-alice","subject":"alice","tenant":"team-a"},{"key":"key-bob","subject":"bob"}]`,
+		expect: keys,
+	},
+	{
+		name: "should reject a key without subject",
+		file: `[{"key":"key-alice"}]`,
+		err:  true,
+	},
+	{
+		name: "should reject a key listed twice",
+		file: `[{"key":"key-alice","subject":"alice"},{"key":"key-alice","subject":"bob"}]`,
+		err:  true,
+	},
+	{
+		name: "should reject an invalid tenant ID",
+		file: `[{"key":"key-alice","subject":"alice","tenant":"../team-a"}]`,
+		err:  true,
+	},
+}
+
+func TestLoadKeys(t *testing.T) {
+	t.Log("loading keys...")
+
+	for _, testcase := range loadKeysTests {
+		t.Log(testcase.name)
+
+		path := filepath.Join(t.TempDir(), "keys.json")
+		os.WriteFile(path, []byte(testcase.file), 0600)
+
+		result, err := LoadKeys(path)
+		if (err != nil) != testcase.err {
+			t.Errorf("=> Got %v expected an error: %v", err, testcase.err)
+		}
+		if err == nil && !reflect.DeepEqual(result, testcase.expect) {
+			t.Errorf("=> Got %v expected %v", result, testcase.expect)
+		}
+	}
+}
+
+func TestLoadSecret(t *testing.T) {
+	t.Log("loading secrets...")
+
+	path := filepath.Join(t.TempDir(), "secret")
+	os.WriteFile(path, append(secret, '\n'), 0600)
+	if result, err := LoadSecret(path); err != nil || string(result) != string(secret) {
+		t.Errorf("=> Got %q, %v expected %q", result, err, secret)
+	}
+
+	os.WriteFile(path, []byte("short"), 0600)
+	if _, err := LoadSecret(path); err == nil {
+		t.Errorf("=> Got no error for a short secret")
+	}
+}
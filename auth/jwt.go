@@ -0,0 +1,102 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/toversus/tbdist/model"
+)
+
+// minSecretLen is the size of the HS256 key recommended by RFC 7518
+const minSecretLen = 32
+
+// Claims are the registered and private claims of a token
+type Claims struct {
+	Subject   string `json:"sub"`
+	Tenant    string `json:"tenant,omitempty"`
+	ExpiresAt int64  `json:"exp"`           // Unix time, required
+	NotBefore int64  `json:"nbf,omitempty"` // Unix time, 0 for no lower bound
+	IssuedAt  int64  `json:"iat,omitempty"`
+}
+
+type header struct {
+	Alg string `json:"alg"`
+	Typ string `json:"typ,omitempty"`
+}
+
+// encodedHeader is the only header the tokens are signed with, any
+// other algorithm is refused
+var encodedHeader = encode(mustMarshal(header{Alg: "HS256", Typ: "JWT"}))
+
+// Sign returns the claims as a JSON Web Token signed with HMAC SHA-256
+func Sign(c Claims, secret []byte) (string, error) {
+	payload, err := json.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+
+	unsigned := encodedHeader + "." + encode(payload)
+	return unsigned + "." + encode(sign(unsigned, secret)), nil
+}
+
+// Verify checks the signature and the validity period of the token
+// and returns its claims. A tenant claim must be a valid tenant ID as
+// the tenant names the data directory of its partition
+func Verify(token string, secret []byte, now time.Time) (Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return Claims{}, ErrInvalidCredentials
+	}
+
+	var h header
+	if err := decodeJSON(parts[0], &h); err != nil || h.Alg != "HS256" {
+		return Claims{}, ErrInvalidCredentials
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil || !hmac.Equal(signature, sign(parts[0]+"."+parts[1], secret)) {
+		return Claims{}, ErrInvalidCredentials
+	}
+
+	var c Claims
+	if err := decodeJSON(parts[1], &c); err != nil || c.Subject == "" || c.ExpiresAt == 0 {
+		return Claims{}, ErrInvalidCredentials
+	}
+	if c.Tenant != "" && !model.ValidProjectID(c.Tenant) {
+		return Claims{}, ErrInvalidCredentials
+	}
+	if now.Unix() >= c.ExpiresAt || now.Unix() < c.NotBefore {
+		return Claims{}, ErrExpired
+	}
+	return c, nil
+}
+
+func sign(unsigned string, secret []byte) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(unsigned))
+	return mac.Sum(nil)
+}
+
+func encode(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeJSON(s string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+func mustMarshal(v interface{}) []byte {
+	b, err := json.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
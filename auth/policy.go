@@ -0,0 +1,104 @@
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// Role groups the permissions granted to a principal
+type Role string
+
+// Roles of the principals, each one is granted the permissions of the
+// previous one
+const (
+	RoleViewer Role = "viewer"
+	RoleMember Role = "member"
+	RoleAdmin  Role = "admin"
+)
+
+// Permissions granted by the roles, the routes declare the ones they need
+const (
+	PermRead   = "tasks:read"      // list and read tasks and projects
+	PermWrite  = "tasks:write"     // create, update and transition tasks
+	PermDelete = "tasks:delete"    // delete tasks
+	PermManage = "projects:manage" // create, update and delete projects and move tasks between them
+	PermBulk   = "tasks:bulk"      // edit many tasks at once
+	PermOthers = "tasks:others"    // change and complete the tasks created by and assigned to others
+)
+
+// grants maps the roles to the permissions they are granted
+var grants = map[Role][]string{
+	RoleViewer: {PermRead},
+	RoleMember: {PermRead, PermWrite},
+	RoleAdmin:  {PermRead, PermWrite, PermDelete, PermManage, PermBulk, PermOthers},
+}
+
+// Binding grants a role to the principal with the subject, within the
+// tenant if any
+type Binding struct {
+	Subject string `json:"subject"`
+	Tenant  string `json:"tenant,omitempty"`
+	Role    Role   `json:"role"`
+}
+
+// Policy decides which permissions are granted to the principals
+type Policy struct {
+	roles map[Principal]Role
+}
+
+// NewPolicy returns a policy granting the roles of the bindings, the
+// principals without binding are granted no permission
+func NewPolicy(bindings []Binding) *Policy {
+	p := &Policy{roles: make(map[Principal]Role)}
+	for _, b := range bindings {
+		p.roles[Principal{Subject: b.Subject, Tenant: b.Tenant}] = b.Role
+	}
+	return p
+}
+
+// LoadPolicy reads a JSON file listing the role bindings such as
+// [{"subject": "alice", "tenant": "team-a", "role": "admin"}]
+func LoadPolicy(path string) (*Policy, error) {
+	j, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var bindings []Binding
+	if err := json.Unmarshal(j, &bindings); err != nil {
+		return nil, fmt.Errorf("roles %s: %v", path, err)
+	}
+
+	seen := make(map[Principal]bool)
+	for i, b := range bindings {
+		if b.Subject == "" {
+			return nil, fmt.Errorf("roles %s: binding %d needs a subject", path, i)
+		}
+		if _, ok := grants[b.Role]; !ok {
+			return nil, fmt.Errorf("roles %s: unknown role %q for %s", path, b.Role, b.Subject)
+		}
+		p := Principal{Subject: b.Subject, Tenant: b.Tenant}
+		if seen[p] {
+			return nil, fmt.Errorf("roles %s: %s is bound more than once", path, b.Subject)
+		}
+		seen[p] = true
+	}
+	return NewPolicy(bindings), nil
+}
+
+// Role returns the role bound to the principal, false when there is none
+func (p *Policy) Role(principal Principal) (Role, bool) {
+	r, ok := p.roles[principal]
+	return r, ok
+}
+
+// Allowed returns true if the role of the principal grants the permission
+func (p *Policy) Allowed(principal Principal, permission string) bool {
+	for _, perm := range grants[p.roles[principal]] {
+		if perm == permission {
+			return true
+		}
+	}
+	return false
+}
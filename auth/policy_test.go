@@ -0,0 +1,143 @@
+package auth
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var policy = NewPolicy([]Binding{
+	{Subject: "alice", Tenant: "team-a", Role: RoleAdmin},
+	{Subject: "bob", Role: RoleMember},
+	{Subject: "carol", Role: RoleViewer},
+})
+
+var allowedTests = []struct {
+	name       string
+	principal  Principal
+	permission string
+	expect     bool
+}{
+	{
+		name:       "should let a viewer read",
+		principal:  Principal{Subject: "carol"},
+		permission: PermRead,
+		expect:     true,
+	},
+	{
+		name:       "should not let a viewer write",
+		principal:  Principal{Subject: "carol"},
+		permission: PermWrite,
+	},
+	{
+		name:       "should let a member write",
+		principal:  Principal{Subject: "bob"},
+		permission: PermWrite,
+		expect:     true,
+	},
+	{
+		name:       "should not let a member delete",
+		principal:  Principal{Subject: "bob"},
+		permission: PermDelete,
+	},
+	{
+		name:       "should let an admin delete",
+		principal:  Principal{Subject: "alice", Tenant: "team-a"},
+		permission: PermDelete,
+		expect:     true,
+	},
+	{
+		name:       "should let an admin manage projects",
+		principal:  Principal{Subject: "alice", Tenant: "team-a"},
+		permission: PermManage,
+		expect:     true,
+	},
+	{
+		name:       "should not let a member bulk edit",
+		principal:  Principal{Subject: "bob"},
+		permission: PermBulk,
+	},
+	{
+		name:       "should let an admin bulk edit",
+		principal:  Principal{Subject: "alice", Tenant: "team-a"},
+		permission: PermBulk,
+		expect:     true,
+	},
+	{
+		name:       "should not grant the role of a tenant to the same subject in another tenant",
+		principal:  Principal{Subject: "alice", Tenant: "team-b"},
+		permission: PermRead,
+	},
+	{
+		name:       "should not let a principal without binding read",
+		principal:  Principal{Subject: "mallory"},
+		permission: PermRead,
+	},
+	{
+		name:       "should not grant an unknown permission",
+		principal:  Principal{Subject: "alice", Tenant: "team-a"},
+		permission: "tasks:destroy",
+	},
+}
+
+func TestAllowed(t *testing.T) {
+	t.Log("checking permissions...")
+
+	for _, testcase := range allowedTests {
+		t.Log(testcase.name)
+
+		if result := policy.Allowed(testcase.principal, testcase.permission); result != testcase.expect {
+			t.Errorf("=> Got %v expected %v", result, testcase.expect)
+		}
+	}
+}
+
+var loadPolicyTests = []struct {
+	name string
+	file string
+	err  bool
+}{
+	{
+		name: "should load the role bindings",
+		file: `[{"subject":"alice","tenant":"team-a","role":"admin"},{"subject":"bob","role":"member"},{"subject":"carol","role":"viewer"}]`,
+	},
+	{
+		name: "should reject an unknown role",
+		file: `[{"subject":"alice","role":"owner"}]`,
+		err:  true,
+	},
+	{
+		name: "should reject a binding without subject",
+		file: `[{"role":"admin"}]`,
+		err:  true,
+	},
+	{
+		name: "should reject a principal bound twice",
+		file: `[{"subject":"bob","role":"member"},{"subject":"bob","role":"admin"}]`,
+		err:  true,
+	},
+}
+
+func TestLoadPolicy(t *testing.T) {
+	t.Log("loading role bindings...")
+
+	for _, testcase := range loadPolicyTests {
+		t.Log(testcase.name)
+
+		path := filepath.Join(t.TempDir(), "roles.json")
+		os.WriteFile(path, []byte(testcase.file), 0600)
+
+		result, err := LoadPolicy(path)
+		if (err != nil) != testcase.err {
+			t.Errorf("=> Got %v expected an error: %v", err, testcase.err)
+		}
+		if err != nil {
+			continue
+		}
+		for _, c := range allowedTests {
+			if allowed := result.Allowed(c.principal, c.permission); allowed != c.expect {
+				t.Errorf("=> Got %v expected %v for %s", allowed, c.expect, c.name)
+			}
+		}
+	}
+}
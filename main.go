@@ -1,21 +1,97 @@
 package main
 
 import (
+	"flag"
 	"log"
 	"net/http"
+	"path/filepath"
+	"time"
 
-	"github.com/toversus/tbdist/router"
+	"github.com/toversus/tbdist/auth"
+	"github.com/toversus/tbdist/model"
 	"github.com/toversus/tbdist/server"
+	"github.com/toversus/tbdist/store"
 )
 
 func main() {
-	r := &router.Router{}
-	r.HandleFunc("/tasks/pending", http.MethodGet, server.GetPendingTasks)
-	r.HandleFunc("/tasks/doing", http.MethodGet, server.GetDoingTasks)
-	r.HandleFunc("/tasks/done", http.MethodGet, server.GetDoneTasks)
-	r.HandleFunc("/tasks/pending?sort=-priority", http.MethodGet, server.GetPendingTasksSortedByPriority)
-	r.HandleFunc("/tasks", http.MethodPost, server.AddTask)
-	r.HandleFunc(`/tasks/\d`, http.MethodPut, server.UpdateTask)
-
-	log.Fatal(http.ListenAndServe(":8080", r))
+	dataDir := flag.String("data", "", "directory to persist tasks in, tasks are kept in memory when empty")
+	interval := flag.Duration("snapshot-interval", 5*time.Minute, "interval between two snapshots of the data directory")
+	workflowFile := flag.String("workflow", "", "JSON file defining the statuses, which include PENDING and DONE, and transitions of the tasks")
+	strictParents := flag.Bool("strict-parents", false, "forbid completing a task before its children")
+	keysFile := flag.String("keys", "", "JSON file listing the API keys and the principal each of them authenticates")
+	secretFile := flag.String("jwt-secret", "", "file holding the secret HS256 bearer tokens are signed with")
+	rolesFile := flag.String("roles", "", "JSON file binding the principals to the viewer, member or admin role, the permissions are enforced when set")
+	multiTenant := flag.Bool("tenants", false, "partition the data per tenant of the authenticated principal")
+	flag.Parse()
+
+	var opts []server.Option
+	if *workflowFile != "" {
+		workflow, err := model.LoadWorkflow(*workflowFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		opts = append(opts, server.WithWorkflow(workflow))
+	}
+	if *strictParents {
+		opts = append(opts, server.WithStrictParents())
+	}
+
+	var authenticator *auth.Authenticator
+	if *keysFile != "" || *secretFile != "" {
+		var keys []auth.Key
+		var secret []byte
+		var err error
+		if *keysFile != "" {
+			if keys, err = auth.LoadKeys(*keysFile); err != nil {
+				log.Fatal(err)
+			}
+		}
+		if *secretFile != "" {
+			if secret, err = auth.LoadSecret(*secretFile); err != nil {
+				log.Fatal(err)
+			}
+		}
+		authenticator = auth.New(keys, secret)
+	}
+	if *rolesFile != "" {
+		if authenticator == nil {
+			log.Fatal("-roles requires -keys or -jwt-secret")
+		}
+		policy, err := auth.LoadPolicy(*rolesFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		opts = append(opts, server.WithPolicy(policy))
+	}
+
+	if *multiTenant {
+		if authenticator == nil {
+			log.Fatal("-tenants requires -keys or -jwt-secret")
+		}
+		tenants := store.NewTenants()
+		if *dataDir != "" {
+			tenants = store.OpenFileTenants(filepath.Join(*dataDir, "tenants"), *interval)
+		}
+		log.Fatal(http.ListenAndServe(":8080", server.NewMultiTenant(server.TenantsOf(tenants), authenticator, opts...)))
+	}
+	if authenticator != nil {
+		opts = append(opts, server.WithAuth(authenticator))
+	}
+
+	var ds server.Store = &store.Datastore{}
+	projects := store.NewProjects()
+	if *dataDir != "" {
+		fs, err := store.OpenFileStore(*dataDir, *interval)
+		if err != nil {
+			log.Fatal(err)
+		}
+		ds = fs
+
+		if projects, err = store.OpenFileProjects(filepath.Join(*dataDir, "projects"), *interval); err != nil {
+			log.Fatal(err)
+		}
+	}
+	opts = append(opts, server.WithProjects(server.ProjectsOf(projects)))
+
+	log.Fatal(http.ListenAndServe(":8080", server.New(ds, opts...)))
 }
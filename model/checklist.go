@@ -0,0 +1,82 @@
+package model
+
+import "math"
+
+// Item is an entry of the checklist of a task
+type Item struct {
+	ID   int    `json:"id"` // unique within the checklist
+	Text string `json:"text"`
+	Done bool   `json:"done"`
+}
+
+// Checklist is an ordered list of items
+type Checklist []Item
+
+// Number returns a copy of the checklist where the items without ID
+// are numbered after the highest ID
+func (c Checklist) Number() Checklist {
+	if c == nil {
+		return nil
+	}
+	c = append(Checklist(nil), c...)
+
+	var last int
+	for _, item := range c {
+		if item.ID > last {
+			last = item.ID
+		}
+	}
+	for i := range c {
+		if c[i].ID == 0 {
+			last++
+			c[i].ID = last
+		}
+	}
+	return c
+}
+
+// Index returns the index of the item with the given ID or -1
+func (c Checklist) Index(id int) int {
+	for i, item := range c {
+		if item.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// Reorder returns the items in the order of the given IDs, which must
+// list every item exactly once
+func (c Checklist) Reorder(ids []int) (Checklist, bool) {
+	if len(ids) != len(c) {
+		return nil, false
+	}
+
+	items := make(Checklist, 0, len(c))
+	seen := make(map[int]bool, len(ids))
+	for _, id := range ids {
+		i := c.Index(id)
+		if i < 0 || seen[id] {
+			return nil, false
+		}
+		seen[id] = true
+		items = append(items, c[i])
+	}
+	return items, true
+}
+
+// Completion returns the ratio of done items rounded to two decimals,
+// a task without checklist has no completion
+func (c Checklist) Completion() (float64, bool) {
+	if len(c) == 0 {
+		return 0, false
+	}
+
+	var done int
+	for _, item := range c {
+		if item.Done {
+			done++
+		}
+	}
+	return math.Round(float64(done)/float64(len(c))*100) / 100, true
+}
@@ -0,0 +1,72 @@
+package model
+
+import "sort"
+
+// NormalizeIDs returns the task IDs sorted and without duplicates
+func NormalizeIDs(ids []int) []int {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	set := make([]int, len(ids))
+	copy(set, ids)
+	sort.Ints(set)
+
+	n := 1
+	for _, id := range set[1:] {
+		if id != set[n-1] {
+			set[n] = id
+			n++
+		}
+	}
+	return set[:n]
+}
+
+// Order returns the tasks in an order where every task comes after its
+// blockers. Among the tasks whose blockers are all listed, the one with
+// the lowest priority number comes first, then the one listed first.
+// Blockers missing from the list are ignored and tasks left on a cycle
+// are not returned
+func Order(tasks Tasks) Tasks {
+	listed := make(map[int]bool, len(tasks))
+	for _, t := range tasks {
+		listed[t.ID] = true
+	}
+
+	blocking := make(map[int]int, len(tasks)) // number of listed blockers left
+	blocked := make(map[int][]int)            // IDs of the tasks each task blocks
+	for _, t := range tasks {
+		for _, b := range t.BlockedBy {
+			if listed[b] {
+				blocking[t.ID]++
+				blocked[b] = append(blocked[b], t.ID)
+			}
+		}
+	}
+
+	var ready, order Tasks
+	for _, t := range tasks {
+		if blocking[t.ID] == 0 {
+			ready = append(ready, t)
+		}
+	}
+
+	byID := make(map[int]Task, len(tasks))
+	for _, t := range tasks {
+		byID[t.ID] = t
+	}
+
+	for len(ready) > 0 {
+		sort.Stable(ByPriority{ready})
+		next := ready[0]
+		ready = ready[1:]
+		order = append(order, next)
+
+		for _, id := range blocked[next.ID] {
+			if blocking[id]--; blocking[id] == 0 {
+				ready = append(ready, byID[id])
+			}
+		}
+	}
+	return order
+}
@@ -0,0 +1,29 @@
+package model
+
+import "regexp"
+
+// projectID matches the IDs of the projects, they appear in URLs and paths
+var projectID = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,63}$`)
+
+// Project is a named list of tasks with its own settings
+type Project struct {
+	ID       string   `json:"id"`
+	Name     string   `json:"name"`
+	Settings Settings `json:"settings"`
+}
+
+// Settings tune how the tasks of a project are validated
+type Settings struct {
+	MinPriority uint8     `json:"min_priority"`       // lowest allowed priority number
+	MaxPriority uint8     `json:"max_priority"`       // highest allowed priority number
+	Workflow    *Workflow `json:"workflow,omitempty"` // nil for the workflow of the server
+}
+
+// DefaultSettings allow priorities from 1 to 10
+var DefaultSettings = Settings{MinPriority: 1, MaxPriority: 10}
+
+// ValidProjectID returns true if the ID is made of lowercase letters,
+// digits, - and _ and starts with a letter or a digit
+func ValidProjectID(id string) bool {
+	return projectID.MatchString(id)
+}
@@ -0,0 +1,122 @@
+package model
+
+import "time"
+
+// SortKey names a task field to sort by and its direction
+type SortKey struct {
+	Field string // id, title, priority, due
+	Desc  bool
+}
+
+// Query describes which tasks to list and in which order
+type Query struct {
+	Status    Status    // empty for every status
+	DueAfter  time.Time // zero for no lower bound on the deadline
+	DueBefore time.Time // zero for no upper bound on the deadline
+	Open      bool      // true to leave out the tasks already done
+	Parent    int       // 0 for tasks of any parent
+	Ready     bool      // true for the pending tasks whose blockers are all done
+	Assignee  string    // empty for tasks of any assignee
+	Tags      []string  // tags every task must have
+	NotTags   []string  // tags no task may have
+	Sort      []SortKey // applied in turn, ties keep the stored order
+}
+
+// Match returns true if the task satisfies every condition of the query
+// but the status of its blockers, which is left to the datastore
+func (q Query) Match(t Task) bool {
+	if q.Status != "" && t.Status != q.Status {
+		return false
+	}
+	if q.Open && t.Status == StatusDone {
+		return false
+	}
+	if q.Ready && t.Status != StatusPending {
+		return false
+	}
+	if q.Assignee != "" && t.Assignee != q.Assignee {
+		return false
+	}
+	if q.Parent != 0 && t.Parent != q.Parent {
+		return false
+	}
+	if !q.DueAfter.IsZero() && (t.Due == nil || t.Due.Before(q.DueAfter)) {
+		return false
+	}
+	if !q.DueBefore.IsZero() && (t.Due == nil || !t.Due.Before(q.DueBefore)) {
+		return false
+	}
+	for _, tag := range q.Tags {
+		if !t.HasTag(tag) {
+			return false
+		}
+	}
+	for _, tag := range q.NotTags {
+		if t.HasTag(tag) {
+			return false
+		}
+	}
+	return true
+}
+
+// IsSortField returns true if tasks can be sorted by the given field
+func IsSortField(field string) bool {
+	switch field {
+	case "id", "title", "priority", "due":
+		return true
+	}
+	return false
+}
+
+// compare returns -1, 0 or 1 depending on whether the field of a is
+// less than, equal to or greater than that of b
+func compare(a, b Task, field string) int {
+	switch field {
+	case "id":
+		return compareInt(a.ID, b.ID)
+	case "title":
+		return compareString(a.Title, b.Title)
+	case "priority":
+		return compareInt(int(a.Priority), int(b.Priority))
+	case "due":
+		return compareTime(a.Due, b.Due)
+	}
+	return 0
+}
+
+func compareInt(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func compareString(a, b string) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// compareTime orders tasks without deadline after every other task
+func compareTime(a, b *time.Time) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return 1
+	case b == nil:
+		return -1
+	case a.Before(*b):
+		return -1
+	case a.After(*b):
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,130 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Frequencies of a recurrence
+const (
+	Daily   = "daily"
+	Weekly  = "weekly"
+	Monthly = "monthly"
+)
+
+// Bounds of the rules, a larger interval or count is more likely a typo
+// than a schedule
+const (
+	MaxInterval = 999
+	MaxCount    = 9999
+)
+
+// weekdays maps the RRULE names of the days to their weekday
+var weekdays = map[string]time.Weekday{
+	"MO": time.Monday,
+	"TU": time.Tuesday,
+	"WE": time.Wednesday,
+	"TH": time.Thursday,
+	"FR": time.Friday,
+	"SA": time.Saturday,
+	"SU": time.Sunday,
+}
+
+// Recurrence is an RRULE-like schedule of a task repeated from its deadline
+type Recurrence struct {
+	Freq     string     `json:"freq"`               // daily, weekly or monthly
+	Interval int        `json:"interval,omitempty"` // every Interval days, weeks or months, 1 when zero
+	ByDay    []string   `json:"by_day,omitempty"`   // MO to SU, days of the week of a weekly recurrence
+	Until    *time.Time `json:"until,omitempty"`    // no occurrence is due after Until
+	Count    int        `json:"count,omitempty"`    // occurrences left including this one, 0 for no limit
+}
+
+// Validate returns an error if the rule is not one of the supported schedules
+func (r Recurrence) Validate() error {
+	switch r.Freq {
+	case Daily, Monthly:
+		if len(r.ByDay) > 0 {
+			return errors.New("by_day is only allowed in a weekly recurrence")
+		}
+	case Weekly:
+		for _, day := range r.ByDay {
+			if _, ok := weekdays[day]; !ok {
+				return errors.New("by_day must list days from MO to SU")
+			}
+		}
+	default:
+		return errors.New("freq must be daily, weekly or monthly")
+	}
+	if r.Interval < 0 || r.Count < 0 {
+		return errors.New("interval and count must not be negative")
+	}
+	if r.Interval > MaxInterval || r.Count > MaxCount {
+		return fmt.Errorf("interval must not exceed %d and count %d", MaxInterval, MaxCount)
+	}
+	return nil
+}
+
+// Next returns the deadline and the rule of the occurrence following the
+// one due at the given time, ok is false when the recurrence is over
+func (r Recurrence) Next(due time.Time) (next time.Time, rule Recurrence, ok bool) {
+	if r.Count == 1 {
+		return time.Time{}, r, false
+	}
+
+	interval := r.Interval
+	if interval == 0 {
+		interval = 1
+	}
+
+	switch r.Freq {
+	case Daily:
+		next = due.AddDate(0, 0, interval)
+	case Weekly:
+		next = nextWeekly(due, interval, r.ByDay)
+	case Monthly:
+		// Months too short for the day of the deadline are skipped
+		for n := interval; ; n += interval {
+			if next = due.AddDate(0, n, 0); next.Day() == due.Day() {
+				break
+			}
+		}
+	}
+
+	if r.Until != nil && next.After(*r.Until) {
+		return time.Time{}, r, false
+	}
+	if r.Count > 0 {
+		r.Count--
+	}
+	return next, r, true
+}
+
+// nextWeekly returns the first day after due falling on one of the days,
+// in the week of due or every interval weeks after it
+func nextWeekly(due time.Time, interval int, days []string) time.Time {
+	if len(days) == 0 {
+		return due.AddDate(0, 0, 7*interval)
+	}
+
+	on := make(map[time.Weekday]bool)
+	for _, day := range days {
+		on[weekdays[day]] = true
+	}
+
+	// Weeks start on Monday, the rest of the week of due comes first
+	start := (int(due.Weekday()) + 6) % 7
+	for n := 1; start+n < 7; n++ {
+		if next := due.AddDate(0, 0, n); on[next.Weekday()] {
+			return next
+		}
+	}
+
+	// Then the week interval weeks after it, which holds every day
+	monday := due.AddDate(0, 0, 7*interval-start)
+	for n := 0; ; n++ {
+		if next := monday.AddDate(0, 0, n); on[next.Weekday()] {
+			return next
+		}
+	}
+}
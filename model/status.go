@@ -0,0 +1,145 @@
+package model
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Status is the state of a task within its workflow
+type Status string
+
+// Statuses of the default workflow
+const (
+	StatusPending Status = "PENDING"
+	StatusDoing   Status = "DOING"
+	StatusDone    Status = "DONE"
+)
+
+// Transition moves a task to a status from any of the listed ones
+type Transition struct {
+	Action string   `json:"action"` // name of the transition such as start
+	From   []Status `json:"from"`
+	To     Status   `json:"to"`
+}
+
+// Workflow defines the statuses of the tasks and the transitions
+// allowed between them
+type Workflow struct {
+	Statuses    []Status     `json:"statuses"`
+	Transitions []Transition `json:"transitions"`
+}
+
+// DefaultWorkflow moves a task from PENDING to DOING then DONE,
+// a completed task has to be reopened explicitly
+var DefaultWorkflow = Workflow{
+	Statuses: []Status{StatusPending, StatusDoing, StatusDone},
+	Transitions: []Transition{
+		{Action: "start", From: []Status{StatusPending}, To: StatusDoing},
+		{Action: "complete", From: []Status{StatusDoing}, To: StatusDone},
+		{Action: "reopen", From: []Status{StatusDone}, To: StatusPending},
+	},
+}
+
+// LoadWorkflow reads a workflow from a JSON file and validates it
+func LoadWorkflow(path string) (Workflow, error) {
+	var w Workflow
+
+	j, err := os.ReadFile(path)
+	if err != nil {
+		return w, err
+	}
+	if err := json.Unmarshal(j, &w); err != nil {
+		return w, fmt.Errorf("workflow %s: %v", path, err)
+	}
+	if err := w.Validate(); err != nil {
+		return w, fmt.Errorf("workflow %s: %v", path, err)
+	}
+	return w, nil
+}
+
+// Validate returns an error if PENDING or DONE is missing, which new
+// tasks and completed tasks rely on, if a status is not upper case as
+// statuses are matched upper-cased in paths and queries, if a transition
+// refers to an unknown status or two transitions share the same action
+func (w Workflow) Validate() error {
+	if len(w.Statuses) == 0 {
+		return errors.New("no status is defined")
+	}
+	for _, s := range w.Statuses {
+		if s == "" || string(s) != strings.ToUpper(string(s)) {
+			return fmt.Errorf("status %q is not upper case", s)
+		}
+	}
+	for _, s := range []Status{StatusPending, StatusDone} {
+		if !w.Valid(s) {
+			return fmt.Errorf("status %s is required", s)
+		}
+	}
+
+	actions := make(map[string]bool)
+	for _, t := range w.Transitions {
+		if t.Action == "" {
+			return fmt.Errorf("a transition to %s has no action", t.To)
+		}
+		if actions[t.Action] {
+			return fmt.Errorf("action %s is defined twice", t.Action)
+		}
+		actions[t.Action] = true
+
+		if !w.Valid(t.To) {
+			return fmt.Errorf("action %s moves to unknown status %s", t.Action, t.To)
+		}
+		for _, from := range t.From {
+			if !w.Valid(from) {
+				return fmt.Errorf("action %s moves from unknown status %s", t.Action, from)
+			}
+		}
+	}
+	return nil
+}
+
+// Valid returns true if the status belongs to the workflow
+func (w Workflow) Valid(s Status) bool {
+	for _, status := range w.Statuses {
+		if status == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Allowed returns true if a task may move from one status to another,
+// keeping the same status is always allowed
+func (w Workflow) Allowed(from, to Status) bool {
+	if from == to {
+		return true
+	}
+	for _, t := range w.Transitions {
+		if t.To == to && t.allows(from) {
+			return true
+		}
+	}
+	return false
+}
+
+// Action returns the transition of the given action
+func (w Workflow) Action(name string) (Transition, bool) {
+	for _, t := range w.Transitions {
+		if t.Action == name {
+			return t, true
+		}
+	}
+	return Transition{}, false
+}
+
+func (t Transition) allows(from Status) bool {
+	for _, s := range t.From {
+		if s == from {
+			return true
+		}
+	}
+	return false
+}
@@ -1,11 +1,78 @@
 package model
 
+import (
+	"encoding/json"
+	"sort"
+	"time"
+)
+
 // Task is thing to be done or completed
 type Task struct {
-	ID       int    `json:"id"`
-	Title    string `json:"title"`
-	Status   string `json:"status"`   // DOING, PENDING, DONE
-	Priority uint8  `json:"priority"` // 1 to 10
+	ID          int         `json:"id"`
+	Title       string      `json:"title"`
+	Description string      `json:"description,omitempty"` // Markdown
+	Status      Status      `json:"status"`                // one of the statuses of the workflow
+	Priority    uint8       `json:"priority"`              // 1 to 10
+	Due         *time.Time  `json:"due,omitempty"`         // RFC 3339 deadline, nil when there is none
+	Tags        []string    `json:"tags,omitempty"`        // sorted set of labels
+	Checklist   Checklist   `json:"checklist,omitempty"`
+	Parent      int         `json:"parent,omitempty"`     // ID of the parent task, 0 for a top-level task
+	BlockedBy   []int       `json:"blocked_by,omitempty"` // sorted IDs of the tasks to be done first
+	Recurrence  *Recurrence `json:"recurrence,omitempty"` // repeats the task from its deadline once done
+	Previous    int         `json:"previous,omitempty"`   // ID of the previous occurrence of a recurring task
+	Next        int         `json:"next,omitempty"`       // ID of the next occurrence, set once the task is done
+	Creator     string      `json:"creator,omitempty"`    // subject of the principal who created the task
+	Assignee    string      `json:"assignee,omitempty"`   // subject of the principal doing the work
+	Version     int         `json:"version,omitempty"`    // incremented by the datastore on every change
+}
+
+// MarshalJSON adds the completion of the checklist to the fields of the task
+func (t Task) MarshalJSON() ([]byte, error) {
+	type task Task // task has no MarshalJSON method
+	v := struct {
+		task
+		Completion *float64 `json:"completion,omitempty"`
+	}{task: task(t)}
+
+	if c, ok := t.Checklist.Completion(); ok {
+		v.Completion = &c
+	}
+	return json.Marshal(v)
+}
+
+// Overdue returns true if the task is not done yet and its deadline has passed
+func (t Task) Overdue(now time.Time) bool {
+	return t.Status != StatusDone && t.Due != nil && t.Due.Before(now)
+}
+
+// HasTag returns true if the task is labelled with the tag
+func (t Task) HasTag(tag string) bool {
+	for _, l := range t.Tags {
+		if l == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// NormalizeTags returns the tags sorted and without duplicates
+func NormalizeTags(tags []string) []string {
+	if len(tags) == 0 {
+		return nil
+	}
+
+	set := make([]string, len(tags))
+	copy(set, tags)
+	sort.Strings(set)
+
+	n := 1
+	for _, tag := range set[1:] {
+		if tag != set[n-1] {
+			set[n] = tag
+			n++
+		}
+	}
+	return set[:n]
 }
 
 // Tasks is just a slice of Task
@@ -30,3 +97,25 @@ type ByPriority struct {
 func (b ByPriority) Less(i, j int) bool {
 	return b.Tasks[i].Priority < b.Tasks[j].Priority
 }
+
+// ByKeys represents types for sorting by several fields in turn
+type ByKeys struct {
+	Tasks
+	Keys []SortKey
+}
+
+// Less returns true if the element of index i comes before that of index j
+// for the first key on which they differ
+func (b ByKeys) Less(i, j int) bool {
+	for _, k := range b.Keys {
+		c := compare(b.Tasks[i], b.Tasks[j], k.Field)
+		if c == 0 {
+			continue
+		}
+		if k.Desc {
+			return c > 0
+		}
+		return c < 0
+	}
+	return false
+}
@@ -0,0 +1,54 @@
+package model
+
+import "encoding/json"
+
+// Node is a task nested with its children
+type Node struct {
+	Task
+	Children []Node `json:"children,omitempty"`
+}
+
+// MarshalJSON adds the children to the fields of the task, which
+// would otherwise be marshaled alone by the method promoted from Task
+func (n Node) MarshalJSON() ([]byte, error) {
+	j, err := json.Marshal(n.Task)
+	if err != nil || len(n.Children) == 0 {
+		return j, err
+	}
+
+	children, err := json.Marshal(n.Children)
+	if err != nil {
+		return nil, err
+	}
+	j = append(j[:len(j)-1], `,"children":`...)
+	j = append(j, children...)
+	return append(j, '}'), nil
+}
+
+// Tree nests the tasks under their parent keeping their order, a task
+// whose parent is not in the list is a root of the tree
+func Tree(tasks Tasks) []Node {
+	ids := make(map[int]bool, len(tasks))
+	for _, t := range tasks {
+		ids[t.ID] = true
+	}
+
+	children := make(map[int]Tasks)
+	var roots Tasks
+	for _, t := range tasks {
+		if t.Parent != 0 && ids[t.Parent] {
+			children[t.Parent] = append(children[t.Parent], t)
+		} else {
+			roots = append(roots, t)
+		}
+	}
+	return nodes(roots, children)
+}
+
+func nodes(tasks Tasks, children map[int]Tasks) []Node {
+	var n []Node
+	for _, t := range tasks {
+		n = append(n, Node{Task: t, Children: nodes(children[t.ID], children)})
+	}
+	return n
+}
@@ -1,38 +1,192 @@
 package router
 
 import (
+	"context"
+	"fmt"
 	"net/http"
 	"regexp"
+	"strings"
 )
 
 // Route defines regex pattern, a handler and HTTP method
 type Route struct {
-	Pattern    *regexp.Regexp
-	Handler    http.Handler
-	HTTPMethod string
+	Pattern     *regexp.Regexp
+	Handler     http.Handler
+	HTTPMethod  string
+	Permissions []string // permissions the caller needs, enforced by a middleware
 }
 
 // Router handles a list of routes
 type Router struct {
-	routes []*Route
+	routes      []*Route
+	middlewares []Middleware
 }
 
-// HandleFunc finds matched endpoint
-func (r *Router) HandleFunc(pattern string, httpMethod string, f func(http.ResponseWriter, *http.Request)) {
+// Middleware wraps the handler of a matched route
+type Middleware func(http.Handler) http.Handler
+
+// placeholder matches named path parameters such as {id} or {id:int}
+var placeholder = regexp.MustCompile(`\{([A-Za-z_]\w*)(?::(\w+))?\}`)
+
+// paramPatterns maps the type of a path parameter to the regex it matches
+var paramPatterns = map[string]string{
+	"":       `[^/]+`,
+	"string": `[^/]+`,
+	"int":    `\d+`,
+}
+
+type paramsKey struct{}
+
+type routeKey struct{}
+
+// HandleFunc registers the handler for the given pattern and HTTP method.
+// The pattern may contain named placeholders such as /tasks/{id:int}
+// whose values are made available to the handler through Param.
+// The permissions declared for the route are made available to the
+// middlewares through Permissions
+func (r *Router) HandleFunc(pattern string, httpMethod string, f func(http.ResponseWriter, *http.Request), permissions ...string) {
 	r.routes = append(r.routes, &Route{
-		Pattern:    regexp.MustCompile(pattern + "$"),
-		Handler:    http.HandlerFunc(f),
-		HTTPMethod: httpMethod,
+		Pattern:     compile(pattern),
+		Handler:     http.HandlerFunc(f),
+		HTTPMethod:  httpMethod,
+		Permissions: permissions,
 	})
 }
 
-// ServeHTTP returns while requested method and pattern is valid
+// Use appends middlewares wrapping the handler of every route, the first
+// one registered is the outermost. Requests matching no route do not go
+// through the middlewares
+func (r *Router) Use(mw ...Middleware) {
+	r.middlewares = append(r.middlewares, mw...)
+}
+
+// ServeHTTP dispatches the request to the route matching its path and method.
+// HEAD requests are served by the GET route of the path when no HEAD route
+// is registered and OPTIONS requests are answered with the allowed methods.
+// Return 405 with an Allow header when the path matches but the method does not
 func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	var fallback *Route
+	var fallbackMatch []string
+	var allowed []string
+
 	for _, route := range r.routes {
-		if route.HTTPMethod == req.Method && route.Pattern.MatchString(req.URL.Path) {
-			route.Handler.ServeHTTP(w, req)
+		m := route.Pattern.FindStringSubmatch(req.URL.Path)
+		if m == nil {
+			continue
+		}
+		if route.HTTPMethod == req.Method {
+			r.wrap(route.Handler).ServeHTTP(w, withRoute(req, route, m))
 			return
 		}
+		if req.Method == http.MethodHead && route.HTTPMethod == http.MethodGet && fallback == nil {
+			fallback, fallbackMatch = route, m
+		}
+		allowed = append(allowed, route.HTTPMethod)
+	}
+
+	if fallback != nil {
+		r.wrap(fallback.Handler).ServeHTTP(headWriter{w}, withRoute(req, fallback, fallbackMatch))
+		return
+	}
+
+	if allowed == nil {
+		http.NotFound(w, req)
+		return
+	}
+
+	w.Header().Set("Allow", allow(allowed))
+	if req.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+}
+
+// Param returns the value of the named path parameter of the matched route
+func Param(r *http.Request, name string) string {
+	p, _ := r.Context().Value(paramsKey{}).(map[string]string)
+	return p[name]
+}
+
+// Permissions returns the permissions declared for the matched route
+func Permissions(r *http.Request) []string {
+	route, _ := r.Context().Value(routeKey{}).(*Route)
+	if route == nil {
+		return nil
 	}
-	http.NotFound(w, req)
+	return route.Permissions
+}
+
+// WithParams returns a shallow copy of the request carrying the given path parameters
+func WithParams(r *http.Request, p map[string]string) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), paramsKey{}, p))
+}
+
+// withRoute returns a shallow copy of the request carrying the matched
+// route and its path parameters
+func withRoute(r *http.Request, route *Route, m []string) *http.Request {
+	r = r.WithContext(context.WithValue(r.Context(), routeKey{}, route))
+	return WithParams(r, params(route.Pattern, m))
+}
+
+// wrap applies the middlewares to the handler
+func (r *Router) wrap(h http.Handler) http.Handler {
+	for i := len(r.middlewares) - 1; i >= 0; i-- {
+		h = r.middlewares[i](h)
+	}
+	return h
+}
+
+// compile translates the placeholders of the pattern into named groups
+// and anchors it so that the whole path has to match
+func compile(pattern string) *regexp.Regexp {
+	expr := placeholder.ReplaceAllStringFunc(pattern, func(s string) string {
+		m := placeholder.FindStringSubmatch(s)
+		p, ok := paramPatterns[m[2]]
+		if !ok {
+			panic(fmt.Sprintf("router: unknown parameter type %q in pattern %q", m[2], pattern))
+		}
+		return "(?P<" + m[1] + ">" + p + ")"
+	})
+	return regexp.MustCompile("^" + expr + "$")
+}
+
+func params(re *regexp.Regexp, m []string) map[string]string {
+	p := make(map[string]string)
+	for i, name := range re.SubexpNames() {
+		if name != "" {
+			p[name] = m[i]
+		}
+	}
+	return p
+}
+
+// allow builds the value of the Allow header from the methods registered
+// for a path, adding HEAD for GET routes and OPTIONS
+func allow(methods []string) string {
+	seen := make(map[string]bool)
+	var list []string
+	add := func(method string) {
+		if !seen[method] {
+			seen[method] = true
+			list = append(list, method)
+		}
+	}
+	for _, method := range methods {
+		add(method)
+		if method == http.MethodGet {
+			add(http.MethodHead)
+		}
+	}
+	add(http.MethodOptions)
+	return strings.Join(list, ", ")
+}
+
+// headWriter discards the body written by a GET handler serving a HEAD request
+type headWriter struct {
+	http.ResponseWriter
+}
+
+func (w headWriter) Write(b []byte) (int, error) {
+	return len(b), nil
 }
@@ -3,6 +3,7 @@ package router
 import (
 	"net/http"
 	"net/http/httptest"
+	"reflect"
 	"testing"
 )
 
@@ -23,12 +24,28 @@ var routeTests = []struct {
 		expect:      http.StatusOK,
 	},
 	{
-		name:        "should response with a status 404 Not Found when HTTP method is different",
+		name:        "should response with a status 405 Method Not Allowed when HTTP method is different",
 		routePath:   "/tasks",
 		routeMethod: http.MethodGet,
 		reqURL:      "/tasks",
 		reqMethod:   http.MethodPost,
-		expect:      http.StatusNotFound,
+		expect:      http.StatusMethodNotAllowed,
+	},
+	{
+		name:        "should response with a status 200 OK when HEAD is requested on a GET route",
+		routePath:   "/tasks",
+		routeMethod: http.MethodGet,
+		reqURL:      "/tasks",
+		reqMethod:   http.MethodHead,
+		expect:      http.StatusOK,
+	},
+	{
+		name:        "should response with a status 204 No Content when OPTIONS is requested on a route",
+		routePath:   "/tasks",
+		routeMethod: http.MethodGet,
+		reqURL:      "/tasks",
+		reqMethod:   http.MethodOptions,
+		expect:      http.StatusNoContent,
 	},
 	{
 		name:        "should response with a status 200 OK when a route match regex and method",
@@ -38,6 +55,14 @@ var routeTests = []struct {
 		reqMethod:   http.MethodGet,
 		expect:      http.StatusOK,
 	},
+	{
+		name:        "should response with a status 404 Not Found when an integer parameter does not match",
+		routePath:   "/tasks/{id:int}",
+		routeMethod: http.MethodGet,
+		reqURL:      "/tasks/a",
+		reqMethod:   http.MethodGet,
+		expect:      http.StatusNotFound,
+	},
 	{
 		name:        "should response with a statu 404 Not Found when route could not be found",
 		routePath:   `/tasks\d`,
@@ -68,3 +93,237 @@ func TestRoute(t *testing.T) {
 		}
 	}
 }
+
+var allowTests = []struct {
+	name      string
+	reqMethod string
+	reqURL    string
+	code      int
+	allow     string
+	body      string
+}{
+	{
+		name:      "should list every method registered for the path",
+		reqMethod: http.MethodPost,
+		reqURL:    "/tasks/1",
+		code:      http.StatusMethodNotAllowed,
+		allow:     "GET, HEAD, PUT, DELETE, OPTIONS",
+		body:      "Method Not Allowed\n",
+	},
+	{
+		name:      "should answer OPTIONS with the allowed methods",
+		reqMethod: http.MethodOptions,
+		reqURL:    "/tasks/1",
+		code:      http.StatusNoContent,
+		allow:     "GET, HEAD, PUT, DELETE, OPTIONS",
+	},
+	{
+		name:      "should serve HEAD without a body",
+		reqMethod: http.MethodHead,
+		reqURL:    "/tasks/1",
+		code:      http.StatusOK,
+	},
+	{
+		name:      "should not set the Allow header when no route matches",
+		reqMethod: http.MethodGet,
+		reqURL:    "/projects",
+		code:      http.StatusNotFound,
+		body:      "404 page not found\n",
+	},
+}
+
+func TestAllow(t *testing.T) {
+	t.Log("checking allowed methods...")
+
+	r := Router{}
+	f := func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}
+	r.HandleFunc("/tasks/{id:int}", http.MethodGet, f)
+	r.HandleFunc("/tasks/{id:int}", http.MethodPut, f)
+	r.HandleFunc("/tasks/{id:int}", http.MethodDelete, f)
+	r.HandleFunc("/tasks", http.MethodPost, f)
+
+	for _, testcase := range allowTests {
+		t.Log(testcase.name)
+
+		rec := httptest.NewRecorder()
+		req, _ := http.NewRequest(testcase.reqMethod, testcase.reqURL, nil)
+
+		r.ServeHTTP(rec, req)
+
+		if rec.Code != testcase.code {
+			t.Errorf("KO => Get %d expected %d", rec.Code, testcase.code)
+		}
+		if allow := rec.Header().Get("Allow"); allow != testcase.allow {
+			t.Errorf("KO => Get %q expected %q", allow, testcase.allow)
+		}
+		if body := rec.Body.String(); body != testcase.body {
+			t.Errorf("KO => Get %q expected %q", body, testcase.body)
+		}
+	}
+}
+
+var paramTests = []struct {
+	name      string
+	routePath string
+	reqURL    string
+	param     string
+	expect    string
+}{
+	{
+		name:      "should extract an integer parameter",
+		routePath: "/tasks/{id:int}",
+		reqURL:    "/tasks/12",
+		param:     "id",
+		expect:    "12",
+	},
+	{
+		name:      "should extract an untyped parameter",
+		routePath: "/tasks/{status}",
+		reqURL:    "/tasks/pending",
+		param:     "status",
+		expect:    "pending",
+	},
+	{
+		name:      "should extract several parameters",
+		routePath: "/projects/{pid}/tasks/{id:int}",
+		reqURL:    "/projects/home/tasks/3",
+		param:     "pid",
+		expect:    "home",
+	},
+	{
+		name:      "should return an empty string for an unknown parameter",
+		routePath: "/tasks/{id:int}",
+		reqURL:    "/tasks/3",
+		param:     "status",
+		expect:    "",
+	},
+}
+
+func TestParam(t *testing.T) {
+	t.Log("extracting path parameters...")
+
+	for _, testcase := range paramTests {
+		t.Log(testcase.name)
+
+		rec := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, testcase.reqURL, nil)
+
+		var got string
+		r := Router{}
+
+		r.HandleFunc(testcase.routePath, http.MethodGet, func(w http.ResponseWriter, r *http.Request) {
+			got = Param(r, testcase.param)
+		})
+
+		r.ServeHTTP(rec, req)
+
+		if got != testcase.expect {
+			t.Errorf("KO => Get %q expected %q", got, testcase.expect)
+		}
+	}
+}
+
+var middlewareTests = []struct {
+	name   string
+	method string
+	reqURL string
+	code   int
+	expect string
+}{
+	{
+		name:   "should run the middlewares in order around the handler",
+		method: http.MethodGet,
+		reqURL: "/tasks/1",
+		code:   http.StatusOK,
+		expect: "first,second,1,",
+	},
+	{
+		name:   "should run the middlewares around a HEAD request",
+		method: http.MethodHead,
+		reqURL: "/tasks/1",
+		code:   http.StatusOK,
+		expect: "first,second,1,",
+	},
+	{
+		name:   "should not run the middlewares when no route matches",
+		method: http.MethodGet,
+		reqURL: "/tags",
+		code:   http.StatusNotFound,
+		expect: "",
+	},
+}
+
+func TestMiddleware(t *testing.T) {
+	t.Log("wrapping handlers...")
+
+	for _, testcase := range middlewareTests {
+		t.Log(testcase.name)
+
+		rec := httptest.NewRecorder()
+		req, _ := http.NewRequest(testcase.method, testcase.reqURL, nil)
+
+		var calls string
+		trace := func(name string) Middleware {
+			return func(next http.Handler) http.Handler {
+				return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					calls += name + ","
+					next.ServeHTTP(w, r)
+				})
+			}
+		}
+
+		r := Router{}
+		r.Use(trace("first"), trace("second"))
+		r.HandleFunc("/tasks/{id:int}", http.MethodGet, func(w http.ResponseWriter, r *http.Request) {
+			calls += Param(r, "id") + ","
+		})
+
+		r.ServeHTTP(rec, req)
+
+		if rec.Code != testcase.code {
+			t.Errorf("KO => Get %d expected %d", rec.Code, testcase.code)
+		}
+		if calls != testcase.expect {
+			t.Errorf("KO => Get %q expected %q", calls, testcase.expect)
+		}
+	}
+}
+
+var permissionTests = []struct {
+	method string
+	reqURL string
+	expect []string
+}{
+	{method: http.MethodGet, reqURL: "/tasks", expect: []string{"tasks:read"}},
+	{method: http.MethodHead, reqURL: "/tasks", expect: []string{"tasks:read"}},
+	{method: http.MethodDelete, reqURL: "/tasks/1", expect: []string{"tasks:read", "tasks:delete"}},
+	{method: http.MethodGet, reqURL: "/me", expect: nil},
+}
+
+func TestPermissions(t *testing.T) {
+	t.Log("declaring permissions...")
+
+	var result []string
+	f := func(w http.ResponseWriter, r *http.Request) {
+		result = Permissions(r)
+	}
+
+	r := Router{}
+	r.HandleFunc("/tasks", http.MethodGet, f, "tasks:read")
+	r.HandleFunc("/tasks/{id:int}", http.MethodDelete, f, "tasks:read", "tasks:delete")
+	r.HandleFunc("/me", http.MethodGet, f)
+
+	for _, testcase := range permissionTests {
+		t.Log(testcase.method, testcase.reqURL)
+
+		result = []string{"unset"}
+		req, _ := http.NewRequest(testcase.method, testcase.reqURL, nil)
+		r.ServeHTTP(httptest.NewRecorder(), req)
+
+		if !reflect.DeepEqual(result, testcase.expect) {
+			t.Errorf("KO => Get %q expected %q", result, testcase.expect)
+		}
+	}
+}
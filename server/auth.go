@@ -0,0 +1,147 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/toversus/tbdist/auth"
+	"github.com/toversus/tbdist/model"
+	"github.com/toversus/tbdist/router"
+)
+
+var (
+	// errNotOwner is returned when the caller changes a task neither
+	// created by nor assigned to them without being granted auth.PermOthers
+	errNotOwner = errors.New("Task is neither created by nor assigned to the caller")
+	// errNotAssignee is returned when the caller completes a task assigned
+	// to someone else without being granted auth.PermOthers
+	errNotAssignee = errors.New("Task can only be done by its assignee")
+	// errNotReassignable is returned when the caller reassigns a task
+	// assigned to someone else without being granted auth.PermOthers
+	errNotReassignable = errors.New("Task can only be reassigned by its assignee")
+)
+
+// Authenticator identifies the caller of a request
+type Authenticator interface {
+	Authenticate(r *http.Request) (auth.Principal, error)
+}
+
+// Authorizer decides whether a principal is granted a permission
+type Authorizer interface {
+	Allowed(p auth.Principal, permission string) bool
+}
+
+// WithAuth requires every request matching a route to be authenticated,
+// the principal is passed to the handlers through the request context
+func WithAuth(a Authenticator) Option {
+	return func(s *Server) {
+		s.auth = a
+	}
+}
+
+// WithPolicy requires the principal of every request matching a route
+// to be granted the permissions declared for the route. The principal
+// is the one of WithAuth or the one set in the context by the caller
+func WithPolicy(p Authorizer) Option {
+	return func(s *Server) {
+		s.policy = p
+	}
+}
+
+// authenticate returns a middleware rejecting the requests the
+// authenticator can not identify the caller of.
+// Return 401 when the credentials are missing, invalid or expired
+func authenticate(a Authenticator) router.Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			p, err := a.Authenticate(r)
+			if err != nil {
+				writeAuthError(w, err)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(auth.WithPrincipal(r.Context(), p)))
+		})
+	}
+}
+
+// authorize returns a middleware rejecting the requests whose principal
+// is not granted the permissions of the route.
+// Return 401 when the request was not authenticated
+// Return 403 when a permission of the route is not granted to the principal
+func authorize(policy Authorizer) router.Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			p, ok := auth.FromContext(r.Context())
+			if !ok {
+				writeAuthError(w, auth.ErrMissingCredentials)
+				return
+			}
+			for _, perm := range router.Permissions(r) {
+				if !policy.Allowed(p, perm) {
+					writeProblem(w, http.StatusForbidden, CodeForbidden, fmt.Sprintf("Permission %s is not granted to %s", perm, p.Subject))
+					return
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// privileged returns true if the caller of the request may act on the
+// tasks of others. Anonymous requests are, as no task has an owner then,
+// while an authenticated caller has to be granted auth.PermOthers, which
+// nobody is without a policy
+func (s *Server) privileged(r *http.Request) bool {
+	p, ok := auth.FromContext(r.Context())
+	if !ok {
+		return true
+	}
+	return s.policy != nil && s.policy.Allowed(p, auth.PermOthers)
+}
+
+// checkOwner returns an error if the caller of the request may not
+// change the task
+func (s *Server) checkOwner(r *http.Request, t model.Task) error {
+	p, _ := auth.FromContext(r.Context())
+	if t.Creator != p.Subject && t.Assignee != p.Subject && !s.privileged(r) {
+		return errNotOwner
+	}
+	return nil
+}
+
+// checkAssignee returns an error if the caller of the request may not
+// give the task the assignee of t. Only the assignee may hand a task
+// over, else the creator could take it and complete it
+func (s *Server) checkAssignee(r *http.Request, current, t model.Task) error {
+	p, _ := auth.FromContext(r.Context())
+	if t.Assignee != current.Assignee && current.Assignee != p.Subject && !s.privileged(r) {
+		return errNotReassignable
+	}
+	return nil
+}
+
+// GetMe handles GET requests on /me.
+// Return 200 with the authenticated principal as a JSON response
+// Return 401 when the request was not authenticated
+func (s *Server) GetMe(w http.ResponseWriter, r *http.Request) {
+	p, ok := auth.FromContext(r.Context())
+	if !ok {
+		writeAuthError(w, auth.ErrMissingCredentials)
+		return
+	}
+	writeJSON(w, http.StatusOK, p)
+}
+
+// writeAuthError replies 401 with a challenge for a bearer token
+func writeAuthError(w http.ResponseWriter, err error) {
+	detail := "A valid API key or bearer token is required"
+	challenge := `Bearer realm="tbdist"`
+	if errors.Is(err, auth.ErrExpired) {
+		detail = "The bearer token has expired"
+		challenge += `, error="invalid_token"`
+	}
+
+	w.Header().Set("WWW-Authenticate", challenge)
+	writeProblem(w, http.StatusUnauthorized, CodeUnauthorized, detail)
+}
@@ -0,0 +1,551 @@
+package server
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/toversus/tbdist/auth"
+	"github.com/toversus/tbdist/model"
+	"github.com/toversus/tbdist/store"
+)
+
+var authTests = []struct {
+	name   string
+	url    string
+	header string
+	code   int
+	expect string
+}{
+	{
+		name:   "should response with the principal of the API key",
+		url:    "/me",
+		header: "Bearer token-a",
+		code:   http.StatusOK,
+		expect: `{"subject":"alice","tenant":"team-a"}`,
+	},
+	{
+		name:   "should response with the principal of the signed token",
+		url:    "/me",
+		header: "Bearer " + mustSign(auth.Claims{Subject: "carol", ExpiresAt: 1 << 40}),
+		code:   http.StatusOK,
+		expect: `{"subject":"carol"}`,
+	},
+	{
+		name:   "should serve the tasks to an authenticated caller",
+		url:    "/tasks",
+		header: "Bearer token-b",
+		code:   http.StatusOK,
+		expect: `null`,
+	},
+	{
+		name: "should response with a status 401 Unauthorized without credentials",
+		url:  "/tasks",
+		code: http.StatusUnauthorized,
+		expect: `{"type":"about:blank","title":"Unauthorized","status":401,` +
+			`"detail":"A valid API key or bearer token is required","code":"unauthorized"}`,
+	},
+	{
+		name:   "should response with a status 401 Unauthorized when the token has expired",
+		url:    "/tasks",
+		header: "Bearer " + mustSign(auth.Claims{Subject: "carol", ExpiresAt: 1}),
+		code:   http.StatusUnauthorized,
+		expect: `{"type":"about:blank","title":"Unauthorized","status":401,` +
+			`"detail":"The bearer token has expired","code":"unauthorized"}`,
+	},
+}
+
+func TestAuth(t *testing.T) {
+	t.Log("authenticating callers...")
+
+	s := New(&store.Datastore{}, WithAuth(tenantAuth))
+	for _, testcase := range authTests {
+		t.Log(testcase.name)
+
+		rec := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, testcase.url, nil)
+		if testcase.header != "" {
+			req.Header.Set("Authorization", testcase.header)
+		}
+
+		s.ServeHTTP(rec, req)
+
+		if rec.Code != testcase.code {
+			t.Errorf("KO => Got %d expected %d", rec.Code, testcase.code)
+		}
+		if result := rec.Body.String(); result != testcase.expect {
+			t.Errorf("KO => Got %s expected %s", result, testcase.expect)
+		}
+		if rec.Code == http.StatusUnauthorized && rec.Header().Get("WWW-Authenticate") == "" {
+			t.Errorf("KO => Got no WWW-Authenticate header")
+		}
+	}
+}
+
+var authorizationTests = []struct {
+	name   string
+	method string
+	url    string
+	body   string
+	token  string
+	code   int
+}{
+	{
+		name:   "should let a viewer list the tasks",
+		method: http.MethodGet,
+		url:    "/tasks",
+		token:  "token-a",
+		code:   http.StatusOK,
+	},
+	{
+		name:   "should let a viewer read a task with a HEAD request",
+		method: http.MethodHead,
+		url:    "/tasks/1",
+		token:  "token-a",
+		code:   http.StatusOK,
+	},
+	{
+		name:   "should response with a status 403 Forbidden when a viewer adds a task",
+		method: http.MethodPost,
+		url:    "/tasks",
+		body:   `{"title":"go to school","status":"PENDING","priority":1}`,
+		token:  "token-a",
+		code:   http.StatusForbidden,
+	},
+	{
+		name:   "should let a member add a task",
+		method: http.MethodPost,
+		url:    "/tasks",
+		body:   `{"title":"go to school","status":"PENDING","priority":1}`,
+		token:  "token-b",
+		code:   http.StatusCreated,
+	},
+	{
+		name:   "should let a member start a task",
+		method: http.MethodPost,
+		url:    "/tasks/1/start",
+		token:  "token-b",
+		code:   http.StatusOK,
+	},
+	{
+		name:   "should response with a status 403 Forbidden when a member completes a task of someone else",
+		method: http.MethodPost,
+		url:    "/tasks/2/complete",
+		token:  "token-b",
+		code:   http.StatusForbidden,
+	},
+	{
+		name:   "should response with a status 403 Forbidden when a member updates a task of someone else",
+		method: http.MethodPut,
+		url:    "/tasks/2",
+		body:   `{"title":"do homework","status":"DOING","priority":2}`,
+		token:  "token-b",
+		code:   http.StatusForbidden,
+	},
+	{
+		name:   "should let an admin update a task of someone else",
+		method: http.MethodPut,
+		url:    "/tasks/2",
+		body:   `{"title":"do homework","status":"DOING","priority":2}`,
+		token:  "token-admin",
+		code:   http.StatusOK,
+	},
+	{
+		name:   "should response with a status 403 Forbidden when a member deletes a task",
+		method: http.MethodDelete,
+		url:    "/tasks/1",
+		token:  "token-b",
+		code:   http.StatusForbidden,
+	},
+	{
+		name:   "should response with a status 403 Forbidden when a member creates a project",
+		method: http.MethodPost,
+		url:    "/projects",
+		body:   `{"id":"api","name":"API"}`,
+		token:  "token-b",
+		code:   http.StatusForbidden,
+	},
+	{
+		name:   "should let an admin delete a task",
+		method: http.MethodDelete,
+		url:    "/tasks/1",
+		token:  "token-admin",
+		code:   http.StatusNoContent,
+	},
+	{
+		name:   "should response with a status 403 Forbidden when a member bulk edits tasks",
+		method: http.MethodPatch,
+		url:    "/tasks",
+		body:   `{"ids":[1],"patch":{"priority":2}}`,
+		token:  "token-b",
+		code:   http.StatusForbidden,
+	},
+	{
+		name:   "should let an admin bulk edit tasks",
+		method: http.MethodPatch,
+		url:    "/tasks",
+		body:   `{"ids":[1],"patch":{"priority":2}}`,
+		token:  "token-admin",
+		code:   http.StatusOK,
+	},
+	{
+		name:   "should let an admin create a project",
+		method: http.MethodPost,
+		url:    "/projects",
+		body:   `{"id":"api","name":"API"}`,
+		token:  "token-admin",
+		code:   http.StatusCreated,
+	},
+	{
+		name:   "should let any authenticated caller read its principal",
+		method: http.MethodGet,
+		url:    "/me",
+		token:  "token-a",
+		code:   http.StatusOK,
+	},
+	{
+		name:   "should response with a status 401 Unauthorized without credentials",
+		method: http.MethodGet,
+		url:    "/tasks",
+		code:   http.StatusUnauthorized,
+	},
+}
+
+func TestAuthorization(t *testing.T) {
+	t.Log("authorizing callers...")
+
+	policy := auth.NewPolicy([]auth.Binding{
+		{Subject: "alice", Tenant: "team-a", Role: auth.RoleViewer},
+		{Subject: "bob", Tenant: "team-b", Role: auth.RoleMember},
+		{Subject: "root", Role: auth.RoleAdmin},
+	})
+
+	for _, testcase := range authorizationTests {
+		t.Log(testcase.name)
+
+		ds := &store.Datastore{}
+		ds.SaveTask(model.Task{Title: "go to school", Status: "PENDING", Priority: 1, Creator: "bob", Assignee: "bob"})
+		ds.SaveTask(model.Task{Title: "do homework", Status: "DOING", Priority: 1, Creator: "root", Assignee: "carol"})
+		s := New(ds, WithAuth(tenantAuth), WithPolicy(policy), WithProjects(ProjectsOf(store.NewProjects())))
+
+		rec := httptest.NewRecorder()
+		req, _ := http.NewRequest(testcase.method, testcase.url, bytes.NewBufferString(testcase.body))
+		if testcase.token != "" {
+			req.Header.Set("Authorization", "Bearer "+testcase.token)
+		}
+
+		s.ServeHTTP(rec, req)
+
+		if rec.Code != testcase.code {
+			t.Errorf("KO => Got %d expected %d", rec.Code, testcase.code)
+		}
+	}
+}
+
+var tenantAuthorizationTests = []struct {
+	token string
+	code  int
+}{
+	{token: "token-a", code: http.StatusOK},
+	{token: "token-b", code: http.StatusForbidden},
+}
+
+func TestTenantAuthorization(t *testing.T) {
+	t.Log("authorizing tenants...")
+
+	policy := auth.NewPolicy([]auth.Binding{{Subject: "alice", Tenant: "team-a", Role: auth.RoleViewer}})
+	m := NewMultiTenant(TenantsOf(store.NewTenants()), tenantAuth, WithPolicy(policy))
+
+	for _, testcase := range tenantAuthorizationTests {
+		t.Log(testcase.token)
+
+		rec := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, "/tasks", nil)
+		req.Header.Set("Authorization", "Bearer "+testcase.token)
+
+		m.ServeHTTP(rec, req)
+
+		if rec.Code != testcase.code {
+			t.Errorf("KO => Got %d expected %d", rec.Code, testcase.code)
+		}
+	}
+}
+
+var ownershipTests = []struct {
+	name   string
+	method string
+	url    string
+	body   string
+	token  string
+	code   int
+	expect string // part of the response body
+}{
+	{
+		name:   "should fill the creator and the assignee of a new task with the caller",
+		method: http.MethodPost,
+		url:    "/tasks",
+		body:   `{"title":"write tests","status":"PENDING","priority":1,"creator":"root"}`,
+		token:  "token-a",
+		code:   http.StatusCreated,
+		expect: `"creator":"alice","assignee":"alice"`,
+	},
+	{
+		name:   "should keep the assignee given for a new task",
+		method: http.MethodPost,
+		url:    "/tasks",
+		body:   `{"title":"write tests","status":"PENDING","priority":1,"assignee":"bob"}`,
+		token:  "token-a",
+		code:   http.StatusCreated,
+		expect: `"creator":"alice","assignee":"bob"`,
+	},
+	{
+		name:   "should list the tasks assigned to the caller",
+		method: http.MethodGet,
+		url:    "/tasks?assignee=me",
+		token:  "token-a",
+		code:   http.StatusOK,
+		expect: `[{"id":2,"title":"review","status":"DOING","priority":1,"creator":"bob","assignee":"alice","version":1}]`,
+	},
+	{
+		name:   "should list the tasks assigned to a subject",
+		method: http.MethodGet,
+		url:    "/tasks?assignee=bob",
+		token:  "token-a",
+		code:   http.StatusOK,
+		expect: `[{"id":1,"title":"fix login","status":"DOING","priority":1,"creator":"alice","assignee":"bob","version":1}]`,
+	},
+	{
+		name:   "should response with a status 403 Forbidden when the creator completes a task assigned to someone else",
+		method: http.MethodPost,
+		url:    "/tasks/1/complete",
+		token:  "token-a",
+		code:   http.StatusForbidden,
+		expect: `"code":"forbidden"`,
+	},
+	{
+		name:   "should response with a status 403 Forbidden when the creator patches the status of a task assigned to someone else",
+		method: http.MethodPatch,
+		url:    "/tasks/1",
+		body:   `{"status":"DONE"}`,
+		token:  "token-a",
+		code:   http.StatusForbidden,
+	},
+	{
+		name:   "should response with a status 403 Forbidden when the creator assigns the task to themselves while completing it",
+		method: http.MethodPut,
+		url:    "/tasks/1",
+		body:   `{"title":"fix login","status":"DONE","priority":1,"assignee":"alice"}`,
+		token:  "token-a",
+		code:   http.StatusForbidden,
+	},
+	{
+		name:   "should response with a status 403 Forbidden when the creator reassigns a task assigned to someone else",
+		method: http.MethodPatch,
+		url:    "/tasks/1",
+		body:   `{"assignee":"alice"}`,
+		token:  "token-a",
+		code:   http.StatusForbidden,
+		expect: `"code":"forbidden"`,
+	},
+	{
+		name:   "should response with a status 403 Forbidden when the creator replaces a task without its assignee",
+		method: http.MethodPut,
+		url:    "/tasks/1",
+		body:   `{"title":"fix login","status":"DOING","priority":1}`,
+		token:  "token-a",
+		code:   http.StatusForbidden,
+	},
+	{
+		name:   "should keep the creator of a replaced task",
+		method: http.MethodPut,
+		url:    "/tasks/2",
+		body:   `{"title":"review","status":"DOING","priority":2,"creator":"alice","assignee":"alice"}`,
+		token:  "token-a",
+		code:   http.StatusOK,
+		expect: `"creator":"bob","assignee":"alice"`,
+	},
+	{
+		name:   "should let the assignee reassign the task",
+		method: http.MethodPatch,
+		url:    "/tasks/1",
+		body:   `{"assignee":"alice"}`,
+		token:  "token-b",
+		code:   http.StatusOK,
+		expect: `"creator":"alice","assignee":"alice"`,
+	},
+	{
+		name:   "should let an admin reassign a task assigned to someone else",
+		method: http.MethodPatch,
+		url:    "/tasks/1",
+		body:   `{"assignee":"carol"}`,
+		token:  "token-admin",
+		code:   http.StatusOK,
+		expect: `"assignee":"carol"`,
+	},
+	{
+		name:   "should let the creator change a task assigned to someone else",
+		method: http.MethodPatch,
+		url:    "/tasks/1",
+		body:   `{"priority":2}`,
+		token:  "token-a",
+		code:   http.StatusOK,
+		expect: `"creator":"alice","assignee":"bob"`,
+	},
+	{
+		name:   "should let the assignee complete the task",
+		method: http.MethodPost,
+		url:    "/tasks/1/complete",
+		token:  "token-b",
+		code:   http.StatusOK,
+		expect: `"status":"DONE"`,
+	},
+	{
+		name:   "should let an admin complete a task assigned to someone else",
+		method: http.MethodPost,
+		url:    "/tasks/1/complete",
+		token:  "token-admin",
+		code:   http.StatusOK,
+		expect: `"status":"DONE"`,
+	},
+}
+
+func TestOwnership(t *testing.T) {
+	t.Log("owning tasks...")
+
+	policy := auth.NewPolicy([]auth.Binding{
+		{Subject: "alice", Tenant: "team-a", Role: auth.RoleMember},
+		{Subject: "bob", Tenant: "team-b", Role: auth.RoleMember},
+		{Subject: "root", Role: auth.RoleAdmin},
+	})
+
+	for _, testcase := range ownershipTests {
+		t.Log(testcase.name)
+
+		ds := &store.Datastore{}
+		ds.SaveTask(model.Task{Title: "fix login", Status: "DOING", Priority: 1, Creator: "alice", Assignee: "bob"})
+		ds.SaveTask(model.Task{Title: "review", Status: "DOING", Priority: 1, Creator: "bob", Assignee: "alice"})
+		s := New(ds, WithAuth(tenantAuth), WithPolicy(policy))
+
+		rec := httptest.NewRecorder()
+		req, _ := http.NewRequest(testcase.method, testcase.url, bytes.NewBufferString(testcase.body))
+		req.Header.Set("Authorization", "Bearer "+testcase.token)
+		req.Header.Set("Content-Type", mergePatchType)
+
+		s.ServeHTTP(rec, req)
+
+		if rec.Code != testcase.code {
+			t.Errorf("KO => Got %d expected %d", rec.Code, testcase.code)
+		}
+		if result := rec.Body.String(); !strings.Contains(result, testcase.expect) {
+			t.Errorf("KO => Got %s expected %s", result, testcase.expect)
+		}
+	}
+}
+
+var ownershipWithoutPolicyTests = []struct {
+	name   string
+	method string
+	url    string
+	body   string
+	code   int
+}{
+	{
+		name:   "should response with a status 403 Forbidden when the creator completes a task assigned to someone else",
+		method: http.MethodPost,
+		url:    "/tasks/1/complete",
+		code:   http.StatusForbidden,
+	},
+	{
+		name:   "should response with a status 403 Forbidden when the creator reassigns a task assigned to someone else",
+		method: http.MethodPatch,
+		url:    "/tasks/1",
+		body:   `{"assignee":"alice"}`,
+		code:   http.StatusForbidden,
+	},
+	{
+		name:   "should response with a status 403 Forbidden when the caller changes a task of others",
+		method: http.MethodPatch,
+		url:    "/tasks/2",
+		body:   `{"priority":2}`,
+		code:   http.StatusForbidden,
+	},
+	{
+		name:   "should let the creator change a task assigned to someone else",
+		method: http.MethodPatch,
+		url:    "/tasks/1",
+		body:   `{"priority":2}`,
+		code:   http.StatusOK,
+	},
+}
+
+func TestOwnershipWithoutPolicy(t *testing.T) {
+	t.Log("owning tasks without roles...")
+
+	for _, testcase := range ownershipWithoutPolicyTests {
+		t.Log(testcase.name)
+
+		ds := &store.Datastore{}
+		ds.SaveTask(model.Task{Title: "fix login", Status: "DOING", Priority: 1, Creator: "alice", Assignee: "bob"})
+		ds.SaveTask(model.Task{Title: "review", Status: "DOING", Priority: 1, Creator: "bob", Assignee: "carol"})
+
+		rec := httptest.NewRecorder()
+		req, _ := http.NewRequest(testcase.method, testcase.url, bytes.NewBufferString(testcase.body))
+		req.Header.Set("Authorization", "Bearer token-a")
+		req.Header.Set("Content-Type", mergePatchType)
+
+		New(ds, WithAuth(tenantAuth)).ServeHTTP(rec, req)
+
+		if rec.Code != testcase.code {
+			t.Errorf("KO => Got %d expected %d", rec.Code, testcase.code)
+		}
+	}
+}
+
+func TestReassignThenComplete(t *testing.T) {
+	t.Log("taking over a task to complete it...")
+
+	policy := auth.NewPolicy([]auth.Binding{{Subject: "alice", Tenant: "team-a", Role: auth.RoleMember}})
+	ds := &store.Datastore{}
+	ds.SaveTask(model.Task{Title: "fix login", Status: "DOING", Priority: 1, Creator: "alice", Assignee: "bob"})
+	s := New(ds, WithAuth(tenantAuth), WithPolicy(policy))
+
+	steps := []struct {
+		method string
+		url    string
+		body   string
+	}{
+		{method: http.MethodPatch, url: "/tasks/1", body: `{"assignee":"alice"}`},
+		{method: http.MethodPost, url: "/tasks/1/complete"},
+	}
+	for _, step := range steps {
+		rec := httptest.NewRecorder()
+		req, _ := http.NewRequest(step.method, step.url, bytes.NewBufferString(step.body))
+		req.Header.Set("Authorization", "Bearer token-a")
+		req.Header.Set("Content-Type", mergePatchType)
+
+		s.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusForbidden {
+			t.Errorf("KO => Got %d expected %d for %s %s", rec.Code, http.StatusForbidden, step.method, step.url)
+		}
+	}
+
+	if task, _ := ds.GetTask(1); task.Assignee != "bob" || task.Status != "DOING" {
+		t.Errorf("KO => Got %#v expected the task still assigned to bob", task)
+	}
+}
+
+func TestAssigneeMeWithoutAuth(t *testing.T) {
+	t.Log("listing my tasks anonymously...")
+
+	rec := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/tasks?assignee=me", nil)
+
+	New(&store.Datastore{}).ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("KO => Got %d expected %d", rec.Code, http.StatusBadRequest)
+	}
+}
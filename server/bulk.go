@@ -0,0 +1,109 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/toversus/tbdist/model"
+)
+
+// bulkEdit is the body of a bulk edit, the patch is an RFC 7386 JSON
+// Merge Patch applied to every task of the list
+type bulkEdit struct {
+	IDs   []int       `json:"ids"`
+	Patch interface{} `json:"patch"`
+}
+
+// BulkEdit handles PATCH requests on /tasks.
+// Every task is patched and checked, then they are saved all together:
+// when one of them can not be saved, none of them is changed.
+// Return 200 with the modified tasks as a JSON response
+// Return 400 when the body could not be decoded, lists no task or the same task twice, or a patched task is invalid
+// Return 403 when the caller may not change one of the tasks
+// Return 404 when one of the tasks does not exist
+// Return 409 when the workflow does not allow the change of status of one of the tasks,
+// or when the parent or a blocker of one of them clashes with the stored tasks
+// Return 412 when one of the tasks was modified while the patch was applied
+// Return 500 when the datastore returned an unexpected error
+func (s *Server) BulkEdit(w http.ResponseWriter, r *http.Request) {
+	var edit bulkEdit
+	if err := json.NewDecoder(r.Body).Decode(&edit); err != nil {
+		writeProblem(w, http.StatusBadRequest, CodeInvalidJSON, err.Error())
+		return
+	}
+	if len(edit.IDs) == 0 {
+		writeProblem(w, http.StatusBadRequest, CodeInvalidPatch, "No task to edit")
+		return
+	}
+	if _, ok := edit.Patch.(map[string]interface{}); !ok {
+		writeProblem(w, http.StatusBadRequest, CodeInvalidPatch, "Patch must be a JSON object")
+		return
+	}
+
+	seen := make(map[int]bool)
+	tasks := make(model.Tasks, 0, len(edit.IDs))
+	for _, id := range edit.IDs {
+		if seen[id] {
+			writeProblem(w, http.StatusBadRequest, CodeInvalidPatch, fmt.Sprintf("Task %d is listed more than once", id))
+			return
+		}
+		seen[id] = true
+
+		t, err := s.bulkPatch(r, id, edit.Patch)
+		var v ValidationError
+		if errors.As(err, &v) {
+			writeProblem(w, http.StatusBadRequest, CodeInvalidTask, fmt.Sprintf("Task %d: %s", id, v.Error()), v...)
+			return
+		}
+		if err != nil {
+			writeStoreError(w, err)
+			return
+		}
+		tasks = append(tasks, t)
+	}
+
+	tasks, err := s.store.SaveTasks(tasks)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, tasks)
+}
+
+// bulkPatch returns the stored task with the patch applied, after the
+// checks of a PATCH on the task alone
+func (s *Server) bulkPatch(r *http.Request, id int, patch interface{}) (model.Task, error) {
+	current, err := s.store.GetTask(id)
+	if err != nil {
+		return current, err
+	}
+	if err := s.checkOwner(r, current); err != nil {
+		return current, err
+	}
+
+	var doc interface{}
+	j, _ := json.Marshal(current)
+	json.Unmarshal(j, &doc)
+
+	var t model.Task
+	j, _ = json.Marshal(mergePatch(doc, patch))
+	if err := json.Unmarshal(j, &t); err != nil {
+		return current, ValidationError{{Field: "patch", Code: "invalid", Detail: err.Error()}}
+	}
+
+	t.ID, t.Version, t.Creator = id, current.Version, current.Creator
+
+	if err := s.validateTask(t); err != nil {
+		return current, err
+	}
+	if err := s.checkAssignee(r, current, t); err != nil {
+		return current, err
+	}
+	if err := s.checkTransition(r, current, t); err != nil {
+		return current, err
+	}
+	return t, nil
+}
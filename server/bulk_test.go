@@ -0,0 +1,164 @@
+package server
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/toversus/tbdist/model"
+	"github.com/toversus/tbdist/store"
+)
+
+var bulkEditTests = []struct {
+	name   string
+	body   string
+	code   int
+	expect string
+	tasks  model.Tasks // stored tasks after the request
+}{
+	{
+		name:   "should patch every listed task",
+		body:   `{"ids":[1,3],"patch":{"status":"DOING","tags":["urgent"]}}`,
+		code:   http.StatusOK,
+		expect: `[{"id":1,"title":"go to school","status":"DOING","priority":1,"tags":["urgent"],"version":2},{"id":3,"title":"play piano","status":"DOING","priority":5,"tags":["urgent"],"version":2}]`,
+		tasks: model.Tasks{
+			{ID: 1, Title: "go to school", Status: "DOING", Priority: 1, Tags: []string{"urgent"}, Version: 2},
+			{ID: 2, Title: "withdraw my money", Status: "DONE", Priority: 3, Version: 1},
+			{ID: 3, Title: "play piano", Status: "DOING", Priority: 5, Tags: []string{"urgent"}, Version: 2},
+		},
+	},
+	{
+		name:   "should response with a status 400 Bad Request and change no task when a patched task is invalid",
+		body:   `{"ids":[1,3],"patch":{"priority":11}}`,
+		code:   http.StatusBadRequest,
+		expect: `{"type":"about:blank","title":"Bad Request","status":400,"detail":"Task 1: Invalid priority number","code":"invalid_task","errors":[{"field":"priority","code":"out_of_range","detail":"Invalid priority number"}]}`,
+	},
+	{
+		name:   "should response with a status 400 Bad Request when a task is listed twice",
+		body:   `{"ids":[1,1],"patch":{"priority":2}}`,
+		code:   http.StatusBadRequest,
+		expect: `{"type":"about:blank","title":"Bad Request","status":400,"detail":"Task 1 is listed more than once","code":"invalid_patch"}`,
+	},
+	{
+		name:   "should response with a status 400 Bad Request when no task is listed",
+		body:   `{"patch":{"priority":2}}`,
+		code:   http.StatusBadRequest,
+		expect: `{"type":"about:blank","title":"Bad Request","status":400,"detail":"No task to edit","code":"invalid_patch"}`,
+	},
+	{
+		name:   "should response with a status 400 Bad Request when the patch is not an object",
+		body:   `{"ids":[1],"patch":[]}`,
+		code:   http.StatusBadRequest,
+		expect: `{"type":"about:blank","title":"Bad Request","status":400,"detail":"Patch must be a JSON object","code":"invalid_patch"}`,
+	},
+	{
+		name:   "should response with a status 404 Not Found and change no task when a task does not exist",
+		body:   `{"ids":[1,4],"patch":{"priority":2}}`,
+		code:   http.StatusNotFound,
+		expect: `{"type":"about:blank","title":"Not Found","status":404,"detail":"Task was not found","code":"task_not_found"}`,
+	},
+	{
+		name:   "should response with a status 409 Conflict and change no task when the workflow does not allow a transition",
+		body:   `{"ids":[1,2],"patch":{"status":"DOING"}}`,
+		code:   http.StatusConflict,
+		expect: `{"type":"about:blank","title":"Conflict","status":409,"detail":"Task can not move from DONE to DOING","code":"illegal_transition"}`,
+	},
+}
+
+func TestBulkEdit(t *testing.T) {
+	t.Log("editing many tasks at once...")
+
+	for _, testcase := range bulkEditTests {
+		t.Log(testcase.name)
+
+		ds := &store.Datastore{}
+		ds.SaveTask(model.Task{Title: "go to school", Status: "PENDING", Priority: 1})
+		ds.SaveTask(model.Task{Title: "withdraw my money", Status: "DONE", Priority: 3})
+		ds.SaveTask(model.Task{Title: "play piano", Status: "PENDING", Priority: 5})
+		before := ds.FindTasks(model.Query{})
+
+		rec := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodPatch, "/tasks", bytes.NewBufferString(testcase.body))
+
+		New(ds).ServeHTTP(rec, req)
+
+		if rec.Code != testcase.code {
+			t.Errorf("KO => Got %d expected %d", rec.Code, testcase.code)
+		}
+		if result := rec.Body.String(); result != testcase.expect {
+			t.Errorf("KO => Got %s expected %s", result, testcase.expect)
+		}
+		expect := testcase.tasks
+		if expect == nil {
+			expect = before
+		}
+		if tasks := ds.FindTasks(model.Query{}); !reflect.DeepEqual(tasks, expect) {
+			t.Errorf("KO => Got %#v expected %#v", tasks, expect)
+		}
+	}
+}
+
+// editedStore changes a task right after it is read, as a concurrent
+// request would
+type editedStore struct {
+	*store.Datastore
+	edited int
+}
+
+func (es editedStore) GetTask(id int) (model.Task, error) {
+	t, err := es.Datastore.GetTask(id)
+	if id == es.edited {
+		changed := t
+		changed.Priority++
+		es.Datastore.SaveTask(changed)
+	}
+	return t, err
+}
+
+var bulkRollbackTests = []struct {
+	name  string
+	body  string
+	store func(ds *store.Datastore) Store
+	code  int
+}{
+	{
+		name:  "should response with a status 409 Conflict and change no task when a parent would create a cycle",
+		body:  `{"ids":[1,2],"patch":{"parent":3}}`,
+		store: func(ds *store.Datastore) Store { return ds },
+		code:  http.StatusConflict,
+	},
+	{
+		name:  "should response with a status 412 Precondition Failed and change no other task when a task is modified meanwhile",
+		body:  `{"ids":[1,2],"patch":{"priority":4}}`,
+		store: func(ds *store.Datastore) Store { return editedStore{Datastore: ds, edited: 2} },
+		code:  http.StatusPreconditionFailed,
+	},
+}
+
+func TestBulkEditRollback(t *testing.T) {
+	t.Log("editing many tasks all together...")
+
+	for _, testcase := range bulkRollbackTests {
+		t.Log(testcase.name)
+
+		ds := &store.Datastore{}
+		ds.SaveTask(model.Task{Title: "go to school", Status: "PENDING", Priority: 1})
+		ds.SaveTask(model.Task{Title: "do homework", Status: "PENDING", Priority: 2})
+		ds.SaveTask(model.Task{Title: "write an essay", Status: "PENDING", Priority: 3, Parent: 2})
+		first, _ := ds.GetTask(1)
+
+		rec := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodPatch, "/tasks", bytes.NewBufferString(testcase.body))
+
+		New(testcase.store(ds)).ServeHTTP(rec, req)
+
+		if rec.Code != testcase.code {
+			t.Errorf("KO => Got %d expected %d", rec.Code, testcase.code)
+		}
+		if task, _ := ds.GetTask(1); !reflect.DeepEqual(task, first) {
+			t.Errorf("KO => Got %#v expected %#v", task, first)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/toversus/tbdist/model"
+	"github.com/toversus/tbdist/router"
+	"github.com/toversus/tbdist/store"
+)
+
+// AddItem handles POST requests on /tasks/{id}/checklist.
+// The body is an item whose text is required, it is appended to the checklist.
+// Return 201 with the modified task as a JSON response, its ETag and the URL
+// of the item in the Location header
+// Return 400 when JSON could not be decoded into an item or its text is empty
+// Return 404 when the task ID is invalid or does not exist
+// Return 412 when the If-Match header does not match the ETag of the task
+func (s *Server) AddItem(w http.ResponseWriter, r *http.Request) {
+	id, err := taskID(r)
+	if err != nil {
+		writeStoreError(w, store.ErrTaskNotFound)
+		return
+	}
+
+	var item model.Item
+
+	if err := json.NewDecoder(r.Body).Decode(&item); err != nil {
+		writeProblem(w, http.StatusBadRequest, CodeInvalidJSON, err.Error())
+		return
+	}
+
+	if item.Text == "" {
+		writeInvalid(w, CodeInvalidTask, invalidField("text", "required", "Item text is missing"))
+		return
+	}
+
+	t, err := s.current(r, id)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	item.ID = 0
+	t.Checklist = append(append(model.Checklist(nil), t.Checklist...), item)
+
+	t, err = s.store.SaveTask(t)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	w.Header().Set("Location", fmt.Sprintf("%s/%d", r.URL.Path, t.Checklist[len(t.Checklist)-1].ID))
+	w.Header().Set("ETag", etag(t))
+	writeJSON(w, http.StatusCreated, t)
+}
+
+// GetItem handles GET requests on /tasks/{id}/checklist/{item}.
+// Return 200 with the item as a JSON response
+// Return 404 when the task or the item does not exist
+func (s *Server) GetItem(w http.ResponseWriter, r *http.Request) {
+	id, err := taskID(r)
+	if err != nil {
+		writeStoreError(w, store.ErrTaskNotFound)
+		return
+	}
+
+	t, err := s.store.GetTask(id)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	itemID, _ := strconv.Atoi(router.Param(r, "item"))
+	i := t.Checklist.Index(itemID)
+	if i < 0 {
+		writeProblem(w, http.StatusNotFound, CodeItemNotFound, "Item was not found")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, t.Checklist[i])
+}
+
+// ToggleItem handles POST requests on /tasks/{id}/checklist/{item}/toggle.
+// Return 200 with the modified task as a JSON response and its ETag
+// Return 404 when the task or the item does not exist
+// Return 412 when the If-Match header does not match the ETag of the task
+func (s *Server) ToggleItem(w http.ResponseWriter, r *http.Request) {
+	id, err := taskID(r)
+	if err != nil {
+		writeStoreError(w, store.ErrTaskNotFound)
+		return
+	}
+
+	t, err := s.current(r, id)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	itemID, _ := strconv.Atoi(router.Param(r, "item"))
+	i := t.Checklist.Index(itemID)
+	if i < 0 {
+		writeProblem(w, http.StatusNotFound, CodeItemNotFound, "Item was not found")
+		return
+	}
+
+	t.Checklist = append(model.Checklist(nil), t.Checklist...)
+	t.Checklist[i].Done = !t.Checklist[i].Done
+
+	t, err = s.store.SaveTask(t)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	w.Header().Set("ETag", etag(t))
+	writeJSON(w, http.StatusOK, t)
+}
+
+// ReorderItems handles PUT requests on /tasks/{id}/checklist/order.
+// The body is the list of the item IDs in their new order.
+// Return 200 with the modified task as a JSON response and its ETag
+// Return 400 when the body does not list every item of the checklist exactly once
+// Return 404 when the task ID is invalid or does not exist
+// Return 412 when the If-Match header does not match the ETag of the task
+func (s *Server) ReorderItems(w http.ResponseWriter, r *http.Request) {
+	id, err := taskID(r)
+	if err != nil {
+		writeStoreError(w, store.ErrTaskNotFound)
+		return
+	}
+
+	var order []int
+
+	if err := json.NewDecoder(r.Body).Decode(&order); err != nil {
+		writeProblem(w, http.StatusBadRequest, CodeInvalidJSON, err.Error())
+		return
+	}
+
+	t, err := s.current(r, id)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	checklist, ok := t.Checklist.Reorder(order)
+	if !ok {
+		writeInvalid(w, CodeInvalidTask, invalidField("order", "invalid", "Order must list every item once"))
+		return
+	}
+	t.Checklist = checklist
+
+	t, err = s.store.SaveTask(t)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	w.Header().Set("ETag", etag(t))
+	writeJSON(w, http.StatusOK, t)
+}
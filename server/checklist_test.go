@@ -0,0 +1,154 @@
+package server
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/toversus/tbdist/model"
+	"github.com/toversus/tbdist/store"
+)
+
+var checklistTests = []struct {
+	name     string
+	method   string
+	url      string
+	body     string
+	code     int
+	location string
+	expect   string
+}{
+	{
+		name:     "should append an item to the checklist",
+		method:   http.MethodPost,
+		url:      "/tasks/1/checklist",
+		body:     `{"text":"pay the bill"}`,
+		code:     http.StatusCreated,
+		location: "/tasks/1/checklist/3",
+		expect:   `{"id":1,"title":"go shopping","status":"DOING","priority":1,"checklist":[{"id":1,"text":"buy bread","done":true},{"id":2,"text":"buy milk","done":false},{"id":3,"text":"pay the bill","done":false}],"version":2,"completion":0.33}`,
+	},
+	{
+		name:   "should response with a status 400 Bad Request when the item has no text",
+		method: http.MethodPost,
+		url:    "/tasks/1/checklist",
+		body:   `{"done":true}`,
+		code:   http.StatusBadRequest,
+		expect: `{"type":"about:blank","title":"Bad Request","status":400,"detail":"Item text is missing","code":"invalid_task","errors":[{"field":"text","code":"required","detail":"Item text is missing"}]}`,
+	},
+	{
+		name:   "should get an item of the checklist",
+		method: http.MethodGet,
+		url:    "/tasks/1/checklist/2",
+		code:   http.StatusOK,
+		expect: `{"id":2,"text":"buy milk","done":false}`,
+	},
+	{
+		name:   "should response with a status 404 Not Found when the item to get does not exist",
+		method: http.MethodGet,
+		url:    "/tasks/1/checklist/3",
+		code:   http.StatusNotFound,
+		expect: `{"type":"about:blank","title":"Not Found","status":404,"detail":"Item was not found","code":"item_not_found"}`,
+	},
+	{
+		name:   "should toggle an item of the checklist",
+		method: http.MethodPost,
+		url:    "/tasks/1/checklist/2/toggle",
+		code:   http.StatusOK,
+		expect: `{"id":1,"title":"go shopping","status":"DOING","priority":1,"checklist":[{"id":1,"text":"buy bread","done":true},{"id":2,"text":"buy milk","done":true}],"version":2,"completion":1}`,
+	},
+	{
+		name:   "should response with a status 404 Not Found when the item does not exist",
+		method: http.MethodPost,
+		url:    "/tasks/1/checklist/3/toggle",
+		code:   http.StatusNotFound,
+		expect: `{"type":"about:blank","title":"Not Found","status":404,"detail":"Item was not found","code":"item_not_found"}`,
+	},
+	{
+		name:   "should reorder the items of the checklist",
+		method: http.MethodPut,
+		url:    "/tasks/1/checklist/order",
+		body:   `[2,1]`,
+		code:   http.StatusOK,
+		expect: `{"id":1,"title":"go shopping","status":"DOING","priority":1,"checklist":[{"id":2,"text":"buy milk","done":false},{"id":1,"text":"buy bread","done":true}],"version":2,"completion":0.5}`,
+	},
+	{
+		name:   "should response with a status 400 Bad Request when an item is missing from the order",
+		method: http.MethodPut,
+		url:    "/tasks/1/checklist/order",
+		body:   `[2,2]`,
+		code:   http.StatusBadRequest,
+		expect: `{"type":"about:blank","title":"Bad Request","status":400,"detail":"Order must list every item once","code":"invalid_task","errors":[{"field":"order","code":"invalid","detail":"Order must list every item once"}]}`,
+	},
+	{
+		name:   "should list tasks with the completion of their checklist",
+		method: http.MethodGet,
+		url:    "/tasks",
+		code:   http.StatusOK,
+		expect: `[{"id":1,"title":"go shopping","status":"DOING","priority":1,"checklist":[{"id":1,"text":"buy bread","done":true},{"id":2,"text":"buy milk","done":false}],"version":1,"completion":0.5},{"id":2,"title":"go to school","status":"DOING","priority":1,"version":1}]`,
+	},
+}
+
+func TestChecklist(t *testing.T) {
+	t.Log("editing checklists...")
+
+	for _, testcase := range checklistTests {
+		t.Log(testcase.name)
+
+		ds := &store.Datastore{}
+		ds.SaveTask(model.Task{Title: "go shopping", Status: model.StatusDoing, Priority: 1, Checklist: model.Checklist{
+			{Text: "buy bread", Done: true},
+			{Text: "buy milk"},
+		}})
+		ds.SaveTask(model.Task{Title: "go to school", Status: model.StatusDoing, Priority: 1})
+
+		rec := httptest.NewRecorder()
+		req, _ := http.NewRequest(testcase.method, testcase.url, bytes.NewBufferString(testcase.body))
+
+		New(ds).ServeHTTP(rec, req)
+
+		if rec.Code != testcase.code {
+			t.Errorf("KO => Got %d expected %d", rec.Code, testcase.code)
+		}
+		if location := rec.Header().Get("Location"); location != testcase.location {
+			t.Errorf("KO => Got %s expected %s", location, testcase.location)
+		}
+		if result := rec.Body.String(); result != testcase.expect {
+			t.Errorf("KO => Got %s expected %s", result, testcase.expect)
+		}
+	}
+}
+
+// sharedStore returns tasks whose checklist shares a backing array with
+// spare capacity, as a checklist loaded from a snapshot may
+type sharedStore struct {
+	*store.Datastore
+	checklist model.Checklist
+}
+
+func (ss sharedStore) GetTask(id int) (model.Task, error) {
+	t, err := ss.Datastore.GetTask(id)
+	t.Checklist = ss.checklist
+	return t, err
+}
+
+func TestAddItemCopiesChecklist(t *testing.T) {
+	t.Log("adding an item to a shared checklist...")
+
+	ds := &store.Datastore{}
+	ds.SaveTask(model.Task{Title: "go to school", Status: "PENDING", Priority: 1, Checklist: model.Checklist{{Text: "pack the bag"}}})
+	shared := make(model.Checklist, 1, 2)
+	shared[0] = model.Item{ID: 1, Text: "pack the bag"}
+
+	rec := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodPost, "/tasks/1/checklist", bytes.NewBufferString(`{"text":"eat breakfast"}`))
+
+	New(sharedStore{Datastore: ds, checklist: shared}).ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusCreated {
+		t.Errorf("KO => Got %d expected %d", rec.Code, http.StatusCreated)
+	}
+	if spare := shared[:2][1]; spare != (model.Item{}) {
+		t.Errorf("KO => Got %v written into the shared checklist", spare)
+	}
+}
@@ -0,0 +1,55 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/toversus/tbdist/model"
+	"github.com/toversus/tbdist/store"
+)
+
+// etag returns the entity tag of the task, derived from its version
+func etag(t model.Task) string {
+	return `"` + strconv.Itoa(t.Version) + `"`
+}
+
+// matchETag returns true if the header lists the entity tag of the task
+// or is *. Weak tags only match with the weak comparison of If-None-Match
+func matchETag(header string, t model.Task, weak bool) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" {
+			return true
+		}
+		if strings.HasPrefix(tag, "W/") {
+			if !weak {
+				continue
+			}
+			tag = tag[2:]
+		}
+		if tag == etag(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// current returns the stored task a modification is based on. A Version
+// Mismatch error is returned when the If-Match header of the request lists
+// no tag matching the task and a Not Owner error when the caller may not
+// change it
+func (s *Server) current(r *http.Request, id int) (model.Task, error) {
+	t, err := s.store.GetTask(id)
+	if err != nil {
+		return t, err
+	}
+
+	if err := s.checkOwner(r, t); err != nil {
+		return t, err
+	}
+	if header := r.Header.Get("If-Match"); header != "" && !matchETag(header, t, false) {
+		return t, store.ErrVersionMismatch
+	}
+	return t, nil
+}
@@ -0,0 +1,138 @@
+package server
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/toversus/tbdist/model"
+	"github.com/toversus/tbdist/store"
+)
+
+var etagTests = []struct {
+	name   string
+	method string
+	header string
+	value  string
+	body   string
+	code   int
+	etag   string
+}{
+	{
+		name:   "should return the ETag of the task",
+		method: http.MethodGet,
+		code:   http.StatusOK,
+		etag:   `"1"`,
+	},
+	{
+		name:   "should response with a status 304 Not Modified when If-None-Match matches",
+		method: http.MethodGet,
+		header: "If-None-Match",
+		value:  `"3", "1"`,
+		code:   http.StatusNotModified,
+		etag:   `"1"`,
+	},
+	{
+		name:   "should compare If-None-Match weakly",
+		method: http.MethodGet,
+		header: "If-None-Match",
+		value:  `W/"1"`,
+		code:   http.StatusNotModified,
+		etag:   `"1"`,
+	},
+	{
+		name:   "should return the task when If-None-Match does not match",
+		method: http.MethodGet,
+		header: "If-None-Match",
+		value:  `"2"`,
+		code:   http.StatusOK,
+		etag:   `"1"`,
+	},
+	{
+		name:   "should update the task when If-Match matches",
+		method: http.MethodPut,
+		header: "If-Match",
+		value:  `"1"`,
+		body:   `{"title":"go to school","status":"DOING","priority":1}`,
+		code:   http.StatusOK,
+		etag:   `"2"`,
+	},
+	{
+		name:   "should update the task when If-Match is *",
+		method: http.MethodPut,
+		header: "If-Match",
+		value:  `*`,
+		body:   `{"title":"go to school","status":"DOING","priority":1}`,
+		code:   http.StatusOK,
+		etag:   `"2"`,
+	},
+	{
+		name:   "should response with a status 412 Precondition Failed when If-Match does not match on update",
+		method: http.MethodPut,
+		header: "If-Match",
+		value:  `"2"`,
+		body:   `{"title":"go to school","status":"DOING","priority":1}`,
+		code:   http.StatusPreconditionFailed,
+	},
+	{
+		name:   "should response with a status 412 Precondition Failed when If-Match does not match on patch",
+		method: http.MethodPatch,
+		header: "If-Match",
+		value:  `"2"`,
+		body:   `{"status":"DOING"}`,
+		code:   http.StatusPreconditionFailed,
+	},
+	{
+		name:   "should patch the task when If-Match matches",
+		method: http.MethodPatch,
+		header: "If-Match",
+		value:  `"1"`,
+		body:   `{"status":"DOING"}`,
+		code:   http.StatusOK,
+		etag:   `"2"`,
+	},
+	{
+		name:   "should compare If-Match strongly",
+		method: http.MethodDelete,
+		header: "If-Match",
+		value:  `W/"1"`,
+		code:   http.StatusPreconditionFailed,
+	},
+	{
+		name:   "should delete the task when If-Match matches",
+		method: http.MethodDelete,
+		header: "If-Match",
+		value:  `"1"`,
+		code:   http.StatusNoContent,
+	},
+}
+
+func TestETag(t *testing.T) {
+	t.Log("checking preconditions...")
+
+	for _, testcase := range etagTests {
+		t.Log(testcase.name)
+
+		ds := &store.Datastore{}
+		ds.SaveTask(model.Task{Title: "go to school", Status: "PENDING", Priority: 1})
+
+		rec := httptest.NewRecorder()
+		req, _ := http.NewRequest(testcase.method, "/tasks/1", bytes.NewBufferString(testcase.body))
+		if testcase.method == http.MethodPatch {
+			req.Header.Set("Content-Type", mergePatchType)
+		}
+		if testcase.header != "" {
+			req.Header.Set(testcase.header, testcase.value)
+		}
+
+		New(ds).ServeHTTP(rec, req)
+
+		if rec.Code != testcase.code {
+			t.Errorf("KO => Got %d expected %d", rec.Code, testcase.code)
+		}
+		if etag := rec.Header().Get("ETag"); etag != testcase.etag {
+			t.Errorf("KO => Got %s expected %s", etag, testcase.etag)
+		}
+	}
+}
@@ -0,0 +1,399 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/toversus/tbdist/model"
+	"github.com/toversus/tbdist/store"
+)
+
+const (
+	mergePatchType = "application/merge-patch+json"
+	jsonPatchType  = "application/json-patch+json"
+)
+
+// errPatchTest is returned when a test operation of a JSON Patch fails
+var errPatchTest = errors.New("Test operation failed")
+
+// PatchTask handles PATCH requests on /tasks/{id}.
+// The body is an RFC 7386 JSON Merge Patch or an RFC 6902 JSON Patch
+// depending on the Content-Type header. The patch is applied to the
+// stored task and the result is validated as a whole before it is saved.
+// Return 200 with the modified task as a JSON response and its ETag
+// Return 400 when the patch could not be decoded or applied or the result is invalid
+// Return 404 when the task ID is invalid or does not exist
+// Return 409 when a test operation of a JSON Patch failed or the workflow
+// does not allow the change of status
+// Return 412 when the If-Match header does not match the ETag of the task
+// or the task was modified while the patch was applied
+// Return 415 when the Content-Type is not one of the patch formats
+func (s *Server) PatchTask(w http.ResponseWriter, r *http.Request) {
+	id, err := taskID(r)
+	if err != nil {
+		writeStoreError(w, store.ErrTaskNotFound)
+		return
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != mergePatchType && mediaType != jsonPatchType {
+		w.Header().Set("Accept-Patch", mergePatchType+", "+jsonPatchType)
+		writeProblem(w, http.StatusUnsupportedMediaType, CodeUnsupportedMediaType,
+			fmt.Sprintf("Content-Type must be %s or %s", mergePatchType, jsonPatchType))
+		return
+	}
+
+	current, err := s.current(r, id)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	var patch interface{}
+	if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+		writeProblem(w, http.StatusBadRequest, CodeInvalidJSON, err.Error())
+		return
+	}
+
+	var doc interface{}
+	j, _ := json.Marshal(current)
+	json.Unmarshal(j, &doc)
+
+	if mediaType == mergePatchType {
+		doc = mergePatch(doc, patch)
+	} else {
+		doc, err = jsonPatch(doc, patch)
+		if err == errPatchTest {
+			writeProblem(w, http.StatusConflict, CodePatchTestFailed, err.Error())
+			return
+		}
+		if err != nil {
+			writeProblem(w, http.StatusBadRequest, CodeInvalidPatch, err.Error())
+			return
+		}
+	}
+
+	var t model.Task
+	j, _ = json.Marshal(doc)
+	if err := json.Unmarshal(j, &t); err != nil {
+		writeProblem(w, http.StatusBadRequest, CodeInvalidPatch, err.Error())
+		return
+	}
+
+	t.ID, t.Version, t.Creator = id, current.Version, current.Creator
+
+	if err := s.validateTask(t); err != nil {
+		writeInvalid(w, CodeInvalidTask, err)
+		return
+	}
+
+	if err := s.checkAssignee(r, current, t); err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	if err := s.checkTransition(r, current, t); err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	t, err = s.store.SaveTask(t)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	w.Header().Set("ETag", etag(t))
+	writeJSON(w, http.StatusOK, t)
+}
+
+// mergePatch applies an RFC 7386 JSON Merge Patch to the target
+func mergePatch(target, patch interface{}) interface{} {
+	p, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+
+	t, ok := target.(map[string]interface{})
+	if !ok {
+		t = make(map[string]interface{})
+	}
+	for k, v := range p {
+		if v == nil {
+			delete(t, k)
+			continue
+		}
+		t[k] = mergePatch(t[k], v)
+	}
+	return t
+}
+
+// patchOp is an operation of an RFC 6902 JSON Patch
+type patchOp struct {
+	Op    string
+	Path  []string
+	From  []string
+	Value interface{}
+}
+
+// jsonPatch applies the operations of an RFC 6902 JSON Patch in turn,
+// the document is left untouched when one of them fails
+func jsonPatch(doc, patch interface{}) (interface{}, error) {
+	ops, err := parsePatch(patch)
+	if err != nil {
+		return nil, err
+	}
+
+	doc = deepCopy(doc)
+	for _, op := range ops {
+		switch op.Op {
+		case "add":
+			doc, err = add(doc, op.Path, op.Value)
+		case "remove":
+			doc, err = remove(doc, op.Path)
+		case "replace":
+			if doc, err = remove(doc, op.Path); err == nil {
+				doc, err = add(doc, op.Path, op.Value)
+			}
+		case "move":
+			var v interface{}
+			if v, err = get(doc, op.From); err == nil {
+				if doc, err = remove(doc, op.From); err == nil {
+					doc, err = add(doc, op.Path, v)
+				}
+			}
+		case "copy":
+			var v interface{}
+			if v, err = get(doc, op.From); err == nil {
+				doc, err = add(doc, op.Path, deepCopy(v))
+			}
+		case "test":
+			var v interface{}
+			if v, err = get(doc, op.Path); err == nil && !reflect.DeepEqual(v, op.Value) {
+				err = errPatchTest
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return doc, nil
+}
+
+func parsePatch(patch interface{}) ([]patchOp, error) {
+	list, ok := patch.([]interface{})
+	if !ok {
+		return nil, errors.New("JSON Patch must be an array of operations")
+	}
+
+	var ops []patchOp
+	for i, item := range list {
+		m, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("Operation %d is not an object", i)
+		}
+
+		var op patchOp
+		op.Op, _ = m["op"].(string)
+		switch op.Op {
+		case "add", "remove", "replace", "move", "copy", "test":
+		default:
+			return nil, fmt.Errorf("Operation %d has an invalid op", i)
+		}
+
+		path, ok := m["path"].(string)
+		if !ok {
+			return nil, fmt.Errorf("Operation %d has no path", i)
+		}
+		var err error
+		if op.Path, err = parsePointer(path); err != nil {
+			return nil, err
+		}
+
+		if op.Op == "move" || op.Op == "copy" {
+			from, ok := m["from"].(string)
+			if !ok {
+				return nil, fmt.Errorf("Operation %d has no from", i)
+			}
+			if op.From, err = parsePointer(from); err != nil {
+				return nil, err
+			}
+			if op.Op == "move" && isPrefix(op.From, op.Path) && len(op.From) < len(op.Path) {
+				return nil, fmt.Errorf("Operation %d moves a value into itself", i)
+			}
+		}
+
+		if op.Op == "add" || op.Op == "replace" || op.Op == "test" {
+			if op.Value, ok = m["value"]; !ok {
+				return nil, fmt.Errorf("Operation %d has no value", i)
+			}
+		}
+		ops = append(ops, op)
+	}
+	return ops, nil
+}
+
+// parsePointer splits an RFC 6901 JSON Pointer into its reference tokens
+func parsePointer(p string) ([]string, error) {
+	if p == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(p, "/") {
+		return nil, fmt.Errorf("Invalid JSON Pointer %q", p)
+	}
+	tokens := strings.Split(p[1:], "/")
+	for i, t := range tokens {
+		tokens[i] = strings.NewReplacer("~1", "/", "~0", "~").Replace(t)
+	}
+	return tokens, nil
+}
+
+func isPrefix(prefix, tokens []string) bool {
+	if len(prefix) > len(tokens) {
+		return false
+	}
+	for i := range prefix {
+		if prefix[i] != tokens[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func get(doc interface{}, path []string) (interface{}, error) {
+	for _, token := range path {
+		switch c := doc.(type) {
+		case map[string]interface{}:
+			v, ok := c[token]
+			if !ok {
+				return nil, fmt.Errorf("Path /%s does not exist", strings.Join(path, "/"))
+			}
+			doc = v
+		case []interface{}:
+			i, err := index(token, len(c)-1)
+			if err != nil {
+				return nil, err
+			}
+			doc = c[i]
+		default:
+			return nil, fmt.Errorf("Path /%s does not exist", strings.Join(path, "/"))
+		}
+	}
+	return doc, nil
+}
+
+func add(doc interface{}, path []string, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	return update(doc, path, func(parent interface{}, token string) (interface{}, error) {
+		switch c := parent.(type) {
+		case map[string]interface{}:
+			c[token] = value
+			return c, nil
+		case []interface{}:
+			i := len(c)
+			if token != "-" {
+				var err error
+				if i, err = index(token, len(c)); err != nil {
+					return nil, err
+				}
+			}
+			c = append(c, nil)
+			copy(c[i+1:], c[i:])
+			c[i] = value
+			return c, nil
+		}
+		return nil, fmt.Errorf("Path /%s does not exist", strings.Join(path, "/"))
+	})
+}
+
+func remove(doc interface{}, path []string) (interface{}, error) {
+	if len(path) == 0 {
+		return nil, errors.New("The whole document can not be removed")
+	}
+	return update(doc, path, func(parent interface{}, token string) (interface{}, error) {
+		switch c := parent.(type) {
+		case map[string]interface{}:
+			if _, ok := c[token]; !ok {
+				return nil, fmt.Errorf("Path /%s does not exist", strings.Join(path, "/"))
+			}
+			delete(c, token)
+			return c, nil
+		case []interface{}:
+			i, err := index(token, len(c)-1)
+			if err != nil {
+				return nil, err
+			}
+			return append(c[:i], c[i+1:]...), nil
+		}
+		return nil, fmt.Errorf("Path /%s does not exist", strings.Join(path, "/"))
+	})
+}
+
+// update applies f to the container holding the last token of the path
+// and returns the document with the container f returned in its place
+func update(doc interface{}, path []string, f func(parent interface{}, token string) (interface{}, error)) (interface{}, error) {
+	if len(path) == 1 {
+		return f(doc, path[0])
+	}
+
+	switch c := doc.(type) {
+	case map[string]interface{}:
+		child, ok := c[path[0]]
+		if !ok {
+			return nil, fmt.Errorf("Path /%s does not exist", path[0])
+		}
+		v, err := update(child, path[1:], f)
+		if err != nil {
+			return nil, err
+		}
+		c[path[0]] = v
+		return c, nil
+	case []interface{}:
+		i, err := index(path[0], len(c)-1)
+		if err != nil {
+			return nil, err
+		}
+		v, err := update(c[i], path[1:], f)
+		if err != nil {
+			return nil, err
+		}
+		c[i] = v
+		return c, nil
+	}
+	return nil, fmt.Errorf("Path /%s does not exist", path[0])
+}
+
+// index parses an array index of a JSON Pointer which must not exceed max
+func index(token string, max int) (int, error) {
+	i, err := strconv.Atoi(token)
+	if err != nil || i < 0 || i > max || (len(token) > 1 && token[0] == '0') {
+		return 0, fmt.Errorf("Invalid array index %q", token)
+	}
+	return i, nil
+}
+
+func deepCopy(v interface{}) interface{} {
+	switch c := v.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(c))
+		for k, v := range c {
+			m[k] = deepCopy(v)
+		}
+		return m
+	case []interface{}:
+		l := make([]interface{}, len(c))
+		for i, v := range c {
+			l[i] = deepCopy(v)
+		}
+		return l
+	}
+	return v
+}
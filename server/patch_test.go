@@ -0,0 +1,153 @@
+package server
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/toversus/tbdist/model"
+	"github.com/toversus/tbdist/store"
+)
+
+func date(day int) *time.Time {
+	t := time.Date(2026, 10, day, 9, 0, 0, 0, time.UTC)
+	return &t
+}
+
+var patchTaskTests = []struct {
+	name        string
+	contentType string
+	body        string
+	code        int
+	expect      string
+}{
+	{
+		name:        "should merge the patch into the stored task",
+		contentType: "application/merge-patch+json",
+		body:        `{"status":"DONE"}`,
+		code:        http.StatusOK,
+		expect:      "{\"id\":1,\"title\":\"go to school\",\"status\":\"DONE\",\"priority\":3,\"due\":\"2026-10-20T09:00:00Z\",\"version\":2}",
+	},
+	{
+		name:        "should remove the members set to null by a merge patch",
+		contentType: "application/merge-patch+json; charset=utf-8",
+		body:        `{"due":null,"priority":5}`,
+		code:        http.StatusOK,
+		expect:      "{\"id\":1,\"title\":\"go to school\",\"status\":\"DOING\",\"priority\":5,\"version\":2}",
+	},
+	{
+		name:        "should ignore an ID set by the patch",
+		contentType: "application/merge-patch+json",
+		body:        `{"id":2}`,
+		code:        http.StatusOK,
+		expect:      "{\"id\":1,\"title\":\"go to school\",\"status\":\"DOING\",\"priority\":3,\"due\":\"2026-10-20T09:00:00Z\",\"version\":2}",
+	},
+	{
+		name:        "should apply the operations of a JSON patch in turn",
+		contentType: "application/json-patch+json",
+		body: `[
+			{"op":"test","path":"/status","value":"DOING"},
+			{"op":"replace","path":"/status","value":"DONE"},
+			{"op":"copy","from":"/priority","path":"/id"},
+			{"op":"move","from":"/due","path":"/hoge"},
+			{"op":"remove","path":"/hoge"},
+			{"op":"add","path":"/title","value":"go to work"}
+		]`,
+		code:   http.StatusOK,
+		expect: "{\"id\":1,\"title\":\"go to work\",\"status\":\"DONE\",\"priority\":3,\"version\":2}",
+	},
+	{
+		name:        "should response with a status 409 Conflict when a test operation fails",
+		contentType: "application/json-patch+json",
+		body:        `[{"op":"test","path":"/status","value":"PENDING"},{"op":"replace","path":"/status","value":"DONE"}]`,
+		code:        http.StatusConflict,
+	},
+	{
+		name:        "should response with a status 400 Bad Request when a path does not exist",
+		contentType: "application/json-patch+json",
+		body:        `[{"op":"remove","path":"/hoge"}]`,
+		code:        http.StatusBadRequest,
+	},
+	{
+		name:        "should response with a status 400 Bad Request when an operation is invalid",
+		contentType: "application/json-patch+json",
+		body:        `[{"op":"hoge","path":"/title"}]`,
+		code:        http.StatusBadRequest,
+	},
+	{
+		name:        "should response with a status 400 Bad Request when the patched task is invalid",
+		contentType: "application/merge-patch+json",
+		body:        `{"title":null,"priority":100}`,
+		code:        http.StatusBadRequest,
+	},
+	{
+		name:        "should response with a status 400 Bad Request when the patched task can't be decoded",
+		contentType: "application/merge-patch+json",
+		body:        `{"priority":"high"}`,
+		code:        http.StatusBadRequest,
+	},
+	{
+		name:        "should response with a status 415 Unsupported Media Type for a plain JSON body",
+		contentType: "application/json",
+		body:        `{"status":"DONE"}`,
+		code:        http.StatusUnsupportedMediaType,
+	},
+}
+
+func TestPatchTask(t *testing.T) {
+	t.Log("patching task...")
+
+	for _, testcase := range patchTaskTests {
+		t.Log(testcase.name)
+
+		ds := &store.Datastore{}
+		ds.SaveTask(model.Task{Title: "go to school", Status: "DOING", Priority: 3, Due: date(20)})
+
+		rec := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodPatch, "/tasks/1", bytes.NewBufferString(testcase.body))
+		req.Header.Set("Content-Type", testcase.contentType)
+
+		New(ds).ServeHTTP(rec, req)
+
+		if rec.Code != testcase.code {
+			t.Errorf("KO => Got %d expected %d: %s", rec.Code, testcase.code, rec.Body.String())
+		}
+		if testcase.expect == "" {
+			continue
+		}
+		if result := rec.Body.String(); result != testcase.expect {
+			t.Errorf("KO => Got %s expected %s", result, testcase.expect)
+		}
+	}
+}
+
+var pointerTests = []struct {
+	pointer string
+	expect  []string
+}{
+	{pointer: "", expect: nil},
+	{pointer: "/", expect: []string{""}},
+	{pointer: "/a~1b/m~0n/0", expect: []string{"a/b", "m~n", "0"}},
+}
+
+func TestParsePointer(t *testing.T) {
+	t.Log("parsing JSON pointers...")
+
+	for _, testcase := range pointerTests {
+		tokens, err := parsePointer(testcase.pointer)
+		if err != nil {
+			t.Errorf("KO => Got %v expected no error", err)
+		}
+		if len(tokens) != len(testcase.expect) {
+			t.Errorf("KO => Got %q expected %q", tokens, testcase.expect)
+			continue
+		}
+		for i := range tokens {
+			if tokens[i] != testcase.expect[i] {
+				t.Errorf("KO => Got %q expected %q", tokens, testcase.expect)
+			}
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/toversus/tbdist/store"
+)
+
+// Error codes are stable and meant to be matched by clients
+const (
+	CodeInvalidJSON          = "invalid_json"
+	CodeInvalidTask          = "invalid_task"
+	CodeInvalidQuery         = "invalid_query"
+	CodeInvalidPatch         = "invalid_patch"
+	CodeInvalidProject       = "invalid_project"
+	CodeTaskNotFound         = "task_not_found"
+	CodeProjectNotFound      = "project_not_found"
+	CodeActionNotFound       = "action_not_found"
+	CodeStatusNotFound       = "status_not_found"
+	CodeItemNotFound         = "item_not_found"
+	CodeConflict             = "conflict"
+	CodeIllegalTransition    = "illegal_transition"
+	CodeOpenChildren         = "open_children"
+	CodePatchTestFailed      = "patch_test_failed"
+	CodePreconditionFailed   = "precondition_failed"
+	CodeUnsupportedMediaType = "unsupported_media_type"
+	CodeUnauthorized         = "unauthorized"
+	CodeForbidden            = "forbidden"
+	CodeInternalError        = "internal_error"
+)
+
+// Problem is an RFC 7807 problem details object
+type Problem struct {
+	Type   string       `json:"type"`
+	Title  string       `json:"title"`
+	Status int          `json:"status"`
+	Detail string       `json:"detail,omitempty"`
+	Code   string       `json:"code"`
+	Errors []FieldError `json:"errors,omitempty"`
+}
+
+// FieldError explains why a field of a request is invalid
+type FieldError struct {
+	Field  string `json:"field"`
+	Code   string `json:"code"` // required, invalid or out_of_range
+	Detail string `json:"detail"`
+}
+
+// ValidationError lists every invalid field of a request
+type ValidationError []FieldError
+
+func (e ValidationError) Error() string {
+	var details []string
+	for _, f := range e {
+		details = append(details, f.Detail)
+	}
+	return strings.Join(details, ", ")
+}
+
+// writeProblem replies with an application/problem+json body
+func writeProblem(w http.ResponseWriter, status int, code string, detail string, errs ...FieldError) {
+	j, _ := json.Marshal(Problem{
+		Type:   "about:blank",
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+		Code:   code,
+		Errors: errs,
+	})
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(status)
+	w.Write(j)
+}
+
+// writeInvalid replies 400 with the invalid fields of the request
+func writeInvalid(w http.ResponseWriter, code string, err error) {
+	var v ValidationError
+	if errors.As(err, &v) {
+		writeProblem(w, http.StatusBadRequest, code, v.Error(), v...)
+		return
+	}
+	writeProblem(w, http.StatusBadRequest, code, err.Error())
+}
+
+// writeStoreError maps an error returned by the datastore or the workflow
+// to a problem. Unexpected errors are logged and hidden from the client
+func writeStoreError(w http.ResponseWriter, err error) {
+	var transition TransitionError
+	switch {
+	case errors.As(err, &transition):
+		writeProblem(w, http.StatusConflict, CodeIllegalTransition, err.Error())
+	case errors.Is(err, errOpenChildren):
+		writeProblem(w, http.StatusConflict, CodeOpenChildren, err.Error())
+	case errors.Is(err, errNotOwner), errors.Is(err, errNotAssignee), errors.Is(err, errNotReassignable):
+		writeProblem(w, http.StatusForbidden, CodeForbidden, err.Error())
+	case errors.Is(err, store.ErrTaskNotFound):
+		writeProblem(w, http.StatusNotFound, CodeTaskNotFound, err.Error())
+	case errors.Is(err, store.ErrProjectNotFound):
+		writeProblem(w, http.StatusNotFound, CodeProjectNotFound, err.Error())
+	case errors.Is(err, store.ErrVersionMismatch):
+		writeProblem(w, http.StatusPreconditionFailed, CodePreconditionFailed, err.Error())
+	case errors.Is(err, store.ErrConflict):
+		writeProblem(w, http.StatusConflict, CodeConflict, err.Error())
+	default:
+		log.Printf("datastore error: %v", err)
+		writeProblem(w, http.StatusInternalServerError, CodeInternalError, "The task could not be processed")
+	}
+}
@@ -0,0 +1,278 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"strconv"
+
+	"github.com/toversus/tbdist/model"
+	"github.com/toversus/tbdist/router"
+	"github.com/toversus/tbdist/store"
+)
+
+// Projects defines the services of the project registry
+type Projects interface {
+	GetProjects() []model.Project
+	GetProject(id string) (model.Project, error)
+	AddProject(p model.Project) (model.Project, error)
+	UpdateProject(p model.Project) (model.Project, error)
+	DeleteProject(id string) error
+	Tasks(id string) (Store, error)
+	MoveTask(from, to string, id, version int) (model.Task, error)
+}
+
+// WithProjects serves the projects of the registry and their tasks
+// under /projects, next to the tasks of the server datastore
+func WithProjects(projects Projects) Option {
+	return func(s *Server) {
+		s.projects = projects
+	}
+}
+
+// ProjectsOf returns the projects of a registry of the store package,
+// whose tasks are served as a Store
+func ProjectsOf(ps *store.Projects) Projects {
+	return storeProjects{ps}
+}
+
+// storeProjects adapts store.Projects to Projects
+type storeProjects struct {
+	*store.Projects
+}
+
+// Tasks returns the datastore of the project as a Store
+func (sp storeProjects) Tasks(id string) (Store, error) {
+	ds, err := sp.Projects.Tasks(id)
+	if err != nil {
+		return nil, err
+	}
+	return ds, nil
+}
+
+// handler is a handler method of Server
+type handler func(s *Server, w http.ResponseWriter, r *http.Request)
+
+// inProject serves the request with a copy of the server working on the
+// tasks and the settings of the {pid} project of the request path
+func (s *Server) inProject(h handler) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		sub, err := s.project(router.Param(r, "pid"))
+		if err != nil {
+			writeStoreError(w, err)
+			return
+		}
+		h(sub, w, r)
+	}
+}
+
+// project returns a copy of the server working on the tasks of the project
+func (s *Server) project(id string) (*Server, error) {
+	p, err := s.projects.GetProject(id)
+	if err != nil {
+		return nil, err
+	}
+	ds, err := s.projects.Tasks(id)
+	if err != nil {
+		return nil, err
+	}
+
+	sub := *s
+	sub.store = ds
+	sub.settings = p.Settings
+	if p.Settings.Workflow != nil {
+		sub.workflow = *p.Settings.Workflow
+	}
+	return &sub, nil
+}
+
+// GetProjects handles GET requests on /projects.
+// Return 200 with every project as a JSON response
+func (s *Server) GetProjects(w http.ResponseWriter, r *http.Request) {
+	p := s.projects.GetProjects()
+	writeJSON(w, http.StatusOK, p)
+}
+
+// GetProject handles GET requests on /projects/{pid}.
+// Return 200 with the project as a JSON response
+// Return 404 when the project does not exist
+func (s *Server) GetProject(w http.ResponseWriter, r *http.Request) {
+	p, err := s.projects.GetProject(router.Param(r, "pid"))
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, p)
+}
+
+// AddProject handles POST requests on /projects.
+// Settings left out default to priorities from 1 to 10 and the workflow of the server.
+// Return 201 with the created project as a JSON response and its URL
+// in the Location header
+// Return 400 when JSON could not be decoded into a project or the project is invalid
+// Return 409 when a project with the same ID already exists
+func (s *Server) AddProject(w http.ResponseWriter, r *http.Request) {
+	var p model.Project
+
+	if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+		writeProblem(w, http.StatusBadRequest, CodeInvalidJSON, err.Error())
+		return
+	}
+
+	p.Settings = withDefaults(p.Settings)
+	if err := validateProject(p); err != nil {
+		writeInvalid(w, CodeInvalidProject, err)
+		return
+	}
+
+	created, err := s.projects.AddProject(p)
+	if errors.Is(err, store.ErrConflict) {
+		writeProblem(w, http.StatusConflict, CodeConflict, fmt.Sprintf("Project %s already exists", p.ID))
+		return
+	}
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	p = created
+
+	w.Header().Set("Location", path.Join(r.URL.Path, p.ID))
+	writeJSON(w, http.StatusCreated, p)
+}
+
+// UpdateProject handles PUT requests on /projects/{pid}.
+// The ID in the path takes precedence over the one in the body.
+// Return 200 with the modified project as a JSON response
+// Return 400 when JSON could not be decoded into a project or the project is invalid
+// Return 404 when the project does not exist
+func (s *Server) UpdateProject(w http.ResponseWriter, r *http.Request) {
+	id := router.Param(r, "pid")
+
+	var p model.Project
+
+	if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+		writeProblem(w, http.StatusBadRequest, CodeInvalidJSON, err.Error())
+		return
+	}
+
+	p.ID = id
+	p.Settings = withDefaults(p.Settings)
+	if err := validateProject(p); err != nil {
+		writeInvalid(w, CodeInvalidProject, err)
+		return
+	}
+
+	p, err := s.projects.UpdateProject(p)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, p)
+}
+
+// DeleteProject handles DELETE requests on /projects/{pid}.
+// Return 204 if the project could be deleted
+// Return 404 when the project does not exist
+// Return 409 when the project still has tasks
+func (s *Server) DeleteProject(w http.ResponseWriter, r *http.Request) {
+	if err := s.projects.DeleteProject(router.Param(r, "pid")); err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// MoveTask handles POST requests on /projects/{pid}/tasks/{id}/move.
+// The body names the target project as {"project": "id"}, the task gets
+// a new ID there and leaves its parent and its blockers behind.
+// Return 201 with the moved task as a JSON response, its ETag and its new URL
+// in the Location header
+// Return 400 when the body is invalid or the task is invalid in the target project
+// Return 404 when the task or one of the projects does not exist
+// Return 409 when the task has children or blocks another task
+// Return 412 when the If-Match header does not match the ETag of the task
+func (s *Server) MoveTask(w http.ResponseWriter, r *http.Request) {
+	from := router.Param(r, "pid")
+	src, err := s.project(from)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	id, err := taskID(r)
+	if err != nil {
+		writeStoreError(w, store.ErrTaskNotFound)
+		return
+	}
+
+	var body struct {
+		Project string `json:"project"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeProblem(w, http.StatusBadRequest, CodeInvalidJSON, err.Error())
+		return
+	}
+	if body.Project == from {
+		writeInvalid(w, CodeInvalidTask, invalidField("project", "invalid", "Task is already in the project"))
+		return
+	}
+
+	dst, err := s.project(body.Project)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	t, err := src.current(r, id)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	if err := dst.validateTask(t); err != nil {
+		writeInvalid(w, CodeInvalidTask, err)
+		return
+	}
+
+	t, err = s.projects.MoveTask(from, body.Project, id, t.Version)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	w.Header().Set("Location", path.Join("/projects", body.Project, "tasks", strconv.Itoa(t.ID)))
+	w.Header().Set("ETag", etag(t))
+	writeJSON(w, http.StatusCreated, t)
+}
+
+// withDefaults fills the priority range left out of the settings
+func withDefaults(settings model.Settings) model.Settings {
+	if settings.MinPriority == 0 && settings.MaxPriority == 0 {
+		settings.MinPriority, settings.MaxPriority = model.DefaultSettings.MinPriority, model.DefaultSettings.MaxPriority
+	}
+	return settings
+}
+
+// validateProject reports every invalid field of the project at once
+func validateProject(p model.Project) error {
+	var errs ValidationError
+	if !model.ValidProjectID(p.ID) {
+		errs = append(errs, FieldError{Field: "id", Code: "invalid", Detail: "Invalid project ID"})
+	}
+	if p.Name == "" {
+		errs = append(errs, FieldError{Field: "name", Code: "required", Detail: "Name is missing"})
+	}
+	if p.Settings.MinPriority == 0 || p.Settings.MinPriority > p.Settings.MaxPriority {
+		errs = append(errs, FieldError{Field: "settings", Code: "out_of_range", Detail: "Invalid priority range"})
+	}
+	if w := p.Settings.Workflow; w != nil {
+		if err := w.Validate(); err != nil {
+			errs = append(errs, FieldError{Field: "settings", Code: "invalid", Detail: "Invalid workflow: " + err.Error()})
+		}
+	}
+	if errs != nil {
+		return errs
+	}
+	return nil
+}
@@ -0,0 +1,204 @@
+package server
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/toversus/tbdist/model"
+	"github.com/toversus/tbdist/store"
+)
+
+var projectTests = []struct {
+	name     string
+	method   string
+	url      string
+	body     string
+	code     int
+	location string
+	expect   string
+}{
+	{
+		name:   "should list the projects",
+		method: http.MethodGet,
+		url:    "/projects",
+		code:   http.StatusOK,
+		expect: `[{"id":"api","name":"API","settings":{"min_priority":1,"max_priority":3}},{"id":"docs","name":"Docs","settings":{"min_priority":1,"max_priority":10}},{"id":"web","name":"Web","settings":{"min_priority":1,"max_priority":10}}]`,
+	},
+	{
+		name:     "should create a project with the default settings",
+		method:   http.MethodPost,
+		url:      "/projects",
+		body:     `{"id":"app","name":"App"}`,
+		code:     http.StatusCreated,
+		location: "/projects/app",
+		expect:   `{"id":"app","name":"App","settings":{"min_priority":1,"max_priority":10}}`,
+	},
+	{
+		name:   "should response with a status 409 Conflict when the project already exists",
+		method: http.MethodPost,
+		url:    "/projects",
+		body:   `{"id":"api","name":"API"}`,
+		code:   http.StatusConflict,
+		expect: `{"type":"about:blank","title":"Conflict","status":409,"detail":"Project api already exists","code":"conflict"}`,
+	},
+	{
+		name:   "should response with a status 400 Bad Request when the project is invalid",
+		method: http.MethodPost,
+		url:    "/projects",
+		body:   `{"id":"My App","settings":{"min_priority":5,"max_priority":2}}`,
+		code:   http.StatusBadRequest,
+		expect: `{"type":"about:blank","title":"Bad Request","status":400,"detail":"Invalid project ID, Name is missing, Invalid priority range","code":"invalid_project","errors":[{"field":"id","code":"invalid","detail":"Invalid project ID"},{"field":"name","code":"required","detail":"Name is missing"},{"field":"settings","code":"out_of_range","detail":"Invalid priority range"}]}`,
+	},
+	{
+		name:   "should update the settings of a project",
+		method: http.MethodPut,
+		url:    "/projects/web",
+		body:   `{"name":"Web","settings":{"min_priority":2,"max_priority":4}}`,
+		code:   http.StatusOK,
+		expect: `{"id":"web","name":"Web","settings":{"min_priority":2,"max_priority":4}}`,
+	},
+	{
+		name:   "should response with a status 409 Conflict when the deleted project has tasks",
+		method: http.MethodDelete,
+		url:    "/projects/api",
+		code:   http.StatusConflict,
+		expect: `{"type":"about:blank","title":"Conflict","status":409,"detail":"Task conflicts with the stored tasks: project api still has tasks","code":"conflict"}`,
+	},
+	{
+		name:   "should delete an empty project",
+		method: http.MethodDelete,
+		url:    "/projects/docs",
+		code:   http.StatusNoContent,
+	},
+	{
+		name:   "should list the tasks of a project only",
+		method: http.MethodGet,
+		url:    "/projects/api/tasks",
+		code:   http.StatusOK,
+		expect: `[{"id":1,"title":"fix login","status":"PENDING","priority":2,"version":1}]`,
+	},
+	{
+		name:   "should list the tasks of the server datastore only",
+		method: http.MethodGet,
+		url:    "/tasks",
+		code:   http.StatusOK,
+		expect: `[{"id":1,"title":"go to school","status":"PENDING","priority":7,"version":1}]`,
+	},
+	{
+		name:     "should add a task to a project",
+		method:   http.MethodPost,
+		url:      "/projects/api/tasks",
+		body:     `{"title":"fix logout","status":"PENDING","priority":3}`,
+		code:     http.StatusCreated,
+		location: "/projects/api/tasks/2",
+		expect:   `{"id":2,"title":"fix logout","status":"PENDING","priority":3,"version":1}`,
+	},
+	{
+		name:   "should response with a status 400 Bad Request when the priority is out of the range of the project",
+		method: http.MethodPost,
+		url:    "/projects/api/tasks",
+		body:   `{"title":"fix logout","status":"PENDING","priority":7}`,
+		code:   http.StatusBadRequest,
+		expect: `{"type":"about:blank","title":"Bad Request","status":400,"detail":"Invalid priority number","code":"invalid_task","errors":[{"field":"priority","code":"out_of_range","detail":"Invalid priority number"}]}`,
+	},
+	{
+		name:   "should list the tasks of a project by status",
+		method: http.MethodGet,
+		url:    "/projects/web/tasks/pending",
+		code:   http.StatusOK,
+		expect: `[{"id":1,"title":"fix button","status":"PENDING","priority":7,"version":1}]`,
+	},
+	{
+		name:   "should response with a status 404 Not Found when the project does not exist",
+		method: http.MethodGet,
+		url:    "/projects/app/tasks/1",
+		code:   http.StatusNotFound,
+		expect: `{"type":"about:blank","title":"Not Found","status":404,"detail":"Project was not found","code":"project_not_found"}`,
+	},
+	{
+		name:     "should move a task to another project",
+		method:   http.MethodPost,
+		url:      "/projects/api/tasks/1/move",
+		body:     `{"project":"web"}`,
+		code:     http.StatusCreated,
+		location: "/projects/web/tasks/2",
+		expect:   `{"id":2,"title":"fix login","status":"PENDING","priority":2,"version":1}`,
+	},
+	{
+		name:   "should response with a status 400 Bad Request when the task is invalid in the target project",
+		method: http.MethodPost,
+		url:    "/projects/web/tasks/1/move",
+		body:   `{"project":"api"}`,
+		code:   http.StatusBadRequest,
+		expect: `{"type":"about:blank","title":"Bad Request","status":400,"detail":"Invalid priority number","code":"invalid_task","errors":[{"field":"priority","code":"out_of_range","detail":"Invalid priority number"}]}`,
+	},
+}
+
+func TestProjects(t *testing.T) {
+	t.Log("managing projects...")
+
+	for _, testcase := range projectTests {
+		t.Log(testcase.name)
+
+		ds := &store.Datastore{}
+		ds.SaveTask(model.Task{Title: "go to school", Status: "PENDING", Priority: 7})
+
+		ps := store.NewProjects()
+		ps.SaveProject(model.Project{ID: "api", Name: "API", Settings: model.Settings{MinPriority: 1, MaxPriority: 3}})
+		ps.SaveProject(model.Project{ID: "web", Name: "Web", Settings: model.DefaultSettings})
+		ps.SaveProject(model.Project{ID: "docs", Name: "Docs", Settings: model.DefaultSettings})
+		api, _ := ps.Tasks("api")
+		api.SaveTask(model.Task{Title: "fix login", Status: "PENDING", Priority: 2})
+		web, _ := ps.Tasks("web")
+		web.SaveTask(model.Task{Title: "fix button", Status: "PENDING", Priority: 7})
+
+		rec := httptest.NewRecorder()
+		req, _ := http.NewRequest(testcase.method, testcase.url, bytes.NewBufferString(testcase.body))
+
+		New(ds, WithProjects(ProjectsOf(ps))).ServeHTTP(rec, req)
+
+		if rec.Code != testcase.code {
+			t.Errorf("KO => Got %d expected %d", rec.Code, testcase.code)
+		}
+		if location := rec.Header().Get("Location"); location != testcase.location {
+			t.Errorf("KO => Got %s expected %s", location, testcase.location)
+		}
+		if result := rec.Body.String(); result != testcase.expect {
+			t.Errorf("KO => Got %s expected %s", result, testcase.expect)
+		}
+	}
+}
+
+// injectedProjects serves the tasks of every project from the same store
+type injectedProjects struct {
+	Projects
+	store Store
+}
+
+func (ip injectedProjects) Tasks(id string) (Store, error) {
+	return ip.store, nil
+}
+
+func TestInjectedProjectStore(t *testing.T) {
+	t.Log("serving the tasks of a project from an injected store...")
+
+	ps := store.NewProjects()
+	ps.SaveProject(model.Project{ID: "api", Name: "API", Settings: model.DefaultSettings})
+	ds := &store.Datastore{}
+	ds.SaveTask(model.Task{Title: "fix login", Status: "PENDING", Priority: 2})
+
+	rec := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/projects/api/tasks/1", nil)
+
+	New(&store.Datastore{}, WithProjects(injectedProjects{Projects: ProjectsOf(ps), store: ds})).ServeHTTP(rec, req)
+
+	expect := `{"id":1,"title":"fix login","status":"PENDING","priority":2,"version":1}`
+	if rec.Code != http.StatusOK {
+		t.Errorf("KO => Got %d expected %d", rec.Code, http.StatusOK)
+	}
+	if result := rec.Body.String(); result != expect {
+		t.Errorf("KO => Got %s expected %s", result, expect)
+	}
+}
@@ -2,117 +2,549 @@ package server
 
 import (
 	"encoding/json"
-	"errors"
-	"log"
 	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/toversus/tbdist/auth"
 	"github.com/toversus/tbdist/model"
+	"github.com/toversus/tbdist/router"
 	"github.com/toversus/tbdist/store"
 )
 
 // Store defines the datastore services
 type Store interface {
-	GetPendingTasks() model.Tasks
-	GetDoingTasks() model.Tasks
-	GetDoneTasks() model.Tasks
-	GetPendingTasksSortedByPriority() model.Tasks
-	SaveTask(task model.Task) error
+	GetTasksByStatus(status model.Status) model.Tasks
+	FindTasks(q model.Query) model.Tasks
+	GetTags() map[string]int
+	GetTask(id int) (model.Task, error)
+	GetBlockers(id int) (model.Tasks, error)
+	SaveTask(task model.Task) (model.Task, error)
+	SaveTasks(tasks model.Tasks) (model.Tasks, error)
+	DeleteTask(id int, version int) error
 }
 
-var ds Store = &store.Datastore{}
+// Server serves the task API on top of a datastore
+type Server struct {
+	store         Store
+	router        *router.Router
+	now           func() time.Time
+	workflow      model.Workflow
+	settings      model.Settings
+	strictParents bool          // strictParents forbids completing a task before its children
+	projects      Projects      // projects is nil when the server only serves its datastore
+	auth          Authenticator // auth is nil when the requests are not authenticated
+	policy        Authorizer    // policy is nil when the permissions of the routes are not enforced
+}
 
-// GetPendingTasks returns pending tasks as a JSON response
-func GetPendingTasks(w http.ResponseWriter, r *http.Request) {
-	t := ds.GetPendingTasks()
-	j, _ := json.Marshal(t)
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(j)
+// Option configures a Server
+type Option func(*Server)
+
+// WithClock sets the function the server reads the current time from
+func WithClock(now func() time.Time) Option {
+	return func(s *Server) {
+		s.now = now
+	}
 }
 
-// GetDoingTasks returns tasks in progress as a JSON response
-func GetDoingTasks(w http.ResponseWriter, r *http.Request) {
-	t := ds.GetDoingTasks()
-	j, _ := json.Marshal(t)
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(j)
+// WithWorkflow sets the statuses of the tasks and the transitions allowed
+// between them, model.DefaultWorkflow is used otherwise
+func WithWorkflow(workflow model.Workflow) Option {
+	return func(s *Server) {
+		s.workflow = workflow
+	}
 }
 
-// GetDoneTasks returns tasks in progress as a JSON response
-func GetDoneTasks(w http.ResponseWriter, r *http.Request) {
-	t := ds.GetDoneTasks()
-	j, _ := json.Marshal(t)
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(j)
+// WithStrictParents forbids a task to move to DONE while some of its
+// children are not done yet
+func WithStrictParents() Option {
+	return func(s *Server) {
+		s.strictParents = true
+	}
 }
 
-// GetPendingTasksSortedByPriority returns tasks in progress sorted by priority as a JSON response
-func GetPendingTasksSortedByPriority(w http.ResponseWriter, r *http.Request) {
-	t := ds.GetPendingTasksSortedByPriority()
-	log.Printf("%+v\n", t)
-	j, _ := json.Marshal(t)
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(j)
+// New returns a server handling the tasks of the given datastore
+func New(store Store, opts ...Option) *Server {
+	s := &Server{
+		store:    store,
+		router:   &router.Router{},
+		now:      time.Now,
+		workflow: model.DefaultWorkflow,
+		settings: model.DefaultSettings,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.auth != nil {
+		s.router.Use(authenticate(s.auth))
+	}
+	if s.policy != nil {
+		s.router.Use(authorize(s.policy))
+	}
+	s.routes()
+	return s
+}
+
+func (s *Server) routes() {
+	s.taskRoutes("", func(h handler) func(http.ResponseWriter, *http.Request) {
+		return func(w http.ResponseWriter, r *http.Request) { h(s, w, r) }
+	})
+	s.router.HandleFunc("/tags", http.MethodGet, s.GetTags, auth.PermRead)
+	s.router.HandleFunc("/me", http.MethodGet, s.GetMe)
+
+	if s.projects == nil {
+		return
+	}
+	s.router.HandleFunc("/projects", http.MethodGet, s.GetProjects, auth.PermRead)
+	s.router.HandleFunc("/projects", http.MethodPost, s.AddProject, auth.PermManage)
+	s.router.HandleFunc("/projects/{pid}", http.MethodGet, s.GetProject, auth.PermRead)
+	s.router.HandleFunc("/projects/{pid}", http.MethodPut, s.UpdateProject, auth.PermManage)
+	s.router.HandleFunc("/projects/{pid}", http.MethodDelete, s.DeleteProject, auth.PermManage)
+	s.router.HandleFunc("/projects/{pid}/tasks/{id:int}/move", http.MethodPost, s.MoveTask, auth.PermManage)
+	s.taskRoutes("/projects/{pid}", s.inProject)
+	s.router.HandleFunc("/projects/{pid}/tags", http.MethodGet, s.inProject((*Server).GetTags), auth.PermRead)
+}
+
+// taskRoutes registers the task handlers under the prefix, wrap binds
+// each of them to the server working on the tasks of the request.
+// Every route declares the permission the caller needs
+func (s *Server) taskRoutes(prefix string, wrap func(handler) func(http.ResponseWriter, *http.Request)) {
+	s.router.HandleFunc(prefix+"/tasks", http.MethodGet, wrap((*Server).GetTasks), auth.PermRead)
+	s.router.HandleFunc(prefix+"/tasks/{id:int}", http.MethodGet, wrap((*Server).GetTask), auth.PermRead)
+	s.router.HandleFunc(prefix+"/tasks/order", http.MethodGet, wrap((*Server).GetOrder), auth.PermRead)
+	s.router.HandleFunc(prefix+"/tasks/{status}", http.MethodGet, wrap((*Server).GetTasksByStatus), auth.PermRead)
+	s.router.HandleFunc(prefix+"/tasks", http.MethodPost, wrap((*Server).AddTask), auth.PermWrite)
+	s.router.HandleFunc(prefix+"/tasks", http.MethodPatch, wrap((*Server).BulkEdit), auth.PermWrite, auth.PermBulk)
+	s.router.HandleFunc(prefix+"/tasks/{id:int}", http.MethodPut, wrap((*Server).UpdateTask), auth.PermWrite)
+	s.router.HandleFunc(prefix+"/tasks/{id:int}", http.MethodPatch, wrap((*Server).PatchTask), auth.PermWrite)
+	s.router.HandleFunc(prefix+"/tasks/{id:int}", http.MethodDelete, wrap((*Server).DeleteTask), auth.PermDelete)
+	s.router.HandleFunc(prefix+"/tasks/{id:int}/children", http.MethodGet, wrap((*Server).GetChildren), auth.PermRead)
+	s.router.HandleFunc(prefix+"/tasks/{id:int}/blockers", http.MethodGet, wrap((*Server).GetBlockers), auth.PermRead)
+	s.router.HandleFunc(prefix+"/tasks/{id:int}/checklist", http.MethodPost, wrap((*Server).AddItem), auth.PermWrite)
+	s.router.HandleFunc(prefix+"/tasks/{id:int}/checklist/{item:int}", http.MethodGet, wrap((*Server).GetItem), auth.PermRead)
+	s.router.HandleFunc(prefix+"/tasks/{id:int}/checklist/order", http.MethodPut, wrap((*Server).ReorderItems), auth.PermWrite)
+	s.router.HandleFunc(prefix+"/tasks/{id:int}/checklist/{item:int}/toggle", http.MethodPost, wrap((*Server).ToggleItem), auth.PermWrite)
+	s.router.HandleFunc(prefix+"/tasks/{id:int}/{action}", http.MethodPost, wrap((*Server).ApplyAction), auth.PermWrite)
+}
+
+// ServeHTTP dispatches the request to the handler of the matching route
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.router.ServeHTTP(w, r)
+}
+
+// GetTasksByStatus handles GET requests on /tasks/{status}.
+// The status is matched case-insensitively against the statuses of the workflow.
+// Return 200 with the tasks in the status as a JSON response
+// Return 404 when the status is not part of the workflow
+func (s *Server) GetTasksByStatus(w http.ResponseWriter, r *http.Request) {
+	status := model.Status(strings.ToUpper(router.Param(r, "status")))
+	if !s.workflow.Valid(status) {
+		writeProblem(w, http.StatusNotFound, CodeStatusNotFound, "Status was not found")
+		return
+	}
+
+	t := s.store.GetTasksByStatus(status)
+	writeJSON(w, http.StatusOK, t)
+}
+
+// GetTasks handles GET requests on /tasks.
+// The status query parameter narrows the list to one status, sort takes
+// a comma separated list of fields where a - prefix stands for descending
+// order and order sets the direction of the other fields (asc or desc).
+// due_before takes an RFC 3339 time and lists the tasks due before it,
+// due_within takes a duration such as 48h and lists the open tasks due
+// within it and overdue=true lists the open tasks whose deadline has passed.
+// Each tag parameter keeps the tasks labelled with the tag, or without it
+// when the tag is prefixed with !. ready=true lists the pending tasks whose
+// blockers are all done. assignee keeps the tasks assigned to the subject,
+// me standing for the caller. tree=true nests the matching tasks
+// under their parent when the parent matches too.
+// Return 200 with the matching tasks as a JSON response
+// Return 400 when a query parameter is invalid
+func (s *Server) GetTasks(w http.ResponseWriter, r *http.Request) {
+	q, err := s.parseQuery(r)
+	if err != nil {
+		writeInvalid(w, CodeInvalidQuery, err)
+		return
+	}
+
+	var tree bool
+	if val := r.URL.Query().Get("tree"); val != "" {
+		if tree, err = strconv.ParseBool(val); err != nil {
+			writeInvalid(w, CodeInvalidQuery, invalidField("tree", "invalid", "Invalid tree"))
+			return
+		}
+	}
+
+	t := s.store.FindTasks(q)
+	if tree {
+		writeJSON(w, http.StatusOK, model.Tree(t))
+		return
+	}
+	writeJSON(w, http.StatusOK, t)
+}
+
+// GetOrder handles GET requests on /tasks/order.
+// Return 200 with every task as a JSON response ordered so that a task
+// comes after its blockers, the lowest priority number first otherwise
+func (s *Server) GetOrder(w http.ResponseWriter, r *http.Request) {
+	t := model.Order(s.store.FindTasks(model.Query{}))
+	writeJSON(w, http.StatusOK, t)
+}
+
+// GetBlockers handles GET requests on /tasks/{id}/blockers.
+// Return 200 with the tasks blocking the task as a JSON response
+// Return 404 when the task ID is invalid or does not exist
+func (s *Server) GetBlockers(w http.ResponseWriter, r *http.Request) {
+	id, err := taskID(r)
+	if err != nil {
+		writeStoreError(w, store.ErrTaskNotFound)
+		return
+	}
+
+	t, err := s.store.GetBlockers(id)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, t)
+}
+
+// GetChildren handles GET requests on /tasks/{id}/children.
+// Return 200 with the direct children of the task as a JSON response
+// Return 404 when the task ID is invalid or does not exist
+func (s *Server) GetChildren(w http.ResponseWriter, r *http.Request) {
+	id, err := taskID(r)
+	if err != nil {
+		writeStoreError(w, store.ErrTaskNotFound)
+		return
+	}
+
+	if _, err := s.store.GetTask(id); err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	t := s.store.FindTasks(model.Query{Parent: id})
+	writeJSON(w, http.StatusOK, t)
+}
+
+// GetTags handles GET requests on /tags.
+// Return 200 with the number of tasks labelled with each tag as a JSON response
+func (s *Server) GetTags(w http.ResponseWriter, r *http.Request) {
+	t := s.store.GetTags()
+	writeJSON(w, http.StatusOK, t)
+}
+
+// GetTask handles GET requests on /tasks/{id}.
+// Return 200 with the task as a JSON response and its ETag
+// Return 304 when the If-None-Match header matches the ETag of the task
+// Return 404 when the task ID is invalid or does not exist
+func (s *Server) GetTask(w http.ResponseWriter, r *http.Request) {
+	id, err := taskID(r)
+	if err != nil {
+		writeStoreError(w, store.ErrTaskNotFound)
+		return
+	}
+
+	t, err := s.store.GetTask(id)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	w.Header().Set("ETag", etag(t))
+	if header := r.Header.Get("If-None-Match"); header != "" && matchETag(header, t, true) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, t)
 }
 
 // AddTask handles POST requests on /tasks.
-// Return 201 if the task could be created
-// Return 400 when JSON could not be decoded into a task
-// datastore returned an error
-func AddTask(w http.ResponseWriter, r *http.Request) {
+// The ID and the version of the body are ignored, a new task is always created.
+// The caller is the creator of the task and its assignee unless another is given.
+// Return 201 with the created task as a JSON response and its URL
+// in the Location header if the task could be created
+// Return 400 when JSON could not be decoded into a task or the task is invalid
+// Return 404, 409 or 500 depending on the error returned by the datastore
+func (s *Server) AddTask(w http.ResponseWriter, r *http.Request) {
 	var t model.Task
 
 	if err := json.NewDecoder(r.Body).Decode(&t); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeProblem(w, http.StatusBadRequest, CodeInvalidJSON, err.Error())
 		return
 	}
 
-	if err := validateTask(t); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	if err := s.validateTask(t); err != nil {
+		writeInvalid(w, CodeInvalidTask, err)
 		return
 	}
 
-	if err := ds.SaveTask(t); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	// A POST never updates a stored task, whatever the ID of the body
+	t.ID, t.Version = 0, 0
+
+	p, _ := auth.FromContext(r.Context())
+	t.Creator = p.Subject
+	if t.Assignee == "" {
+		t.Assignee = p.Subject
+	}
+
+	t, err := s.store.SaveTask(t)
+	if err != nil {
+		writeStoreError(w, err)
 		return
 	}
 
-	w.WriteHeader(http.StatusCreated)
+	w.Header().Set("Location", path.Join(r.URL.Path, strconv.Itoa(t.ID)))
+	w.Header().Set("ETag", etag(t))
+	writeJSON(w, http.StatusCreated, t)
 }
 
-// UpdateTask handles requests for updating an existing task,
-// Return 200 if the task could be modified
-// Return 400 when JSON could not be decoded into a task or
-// datastore returned an error or task title is empty
-func UpdateTask(w http.ResponseWriter, r *http.Request) {
+// UpdateTask handles PUT requests on /tasks/{id}.
+// The ID in the path takes precedence over the one in the body and
+// the If-Match header over its version.
+// Return 200 with the modified task as a JSON response and its ETag
+// Return 400 when JSON could not be decoded into a task or the task is invalid
+// Return 404 when the task ID is invalid or does not exist
+// Return 409 when the workflow does not allow the change of status
+// Return 412 when the If-Match header does not match the ETag of the task
+// Return 500 when the datastore returned an unexpected error
+func (s *Server) UpdateTask(w http.ResponseWriter, r *http.Request) {
+	id, err := taskID(r)
+	if err != nil {
+		writeStoreError(w, store.ErrTaskNotFound)
+		return
+	}
+
 	var t model.Task
 
 	if err := json.NewDecoder(r.Body).Decode(&t); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeProblem(w, http.StatusBadRequest, CodeInvalidJSON, err.Error())
+		return
+	}
+
+	t.ID = id
+
+	if err := s.validateTask(t); err != nil {
+		writeInvalid(w, CodeInvalidTask, err)
+		return
+	}
+
+	current, err := s.current(r, id)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	// The creator is kept, only the assignee may change
+	t.Creator = current.Creator
+	if err := s.checkAssignee(r, current, t); err != nil {
+		writeStoreError(w, err)
 		return
 	}
 
-	if err := validateTask(t); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	if err := s.checkTransition(r, current, t); err != nil {
+		writeStoreError(w, err)
 		return
 	}
 
-	if err := ds.SaveTask(t); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	t.Version = current.Version
+
+	t, err = s.store.SaveTask(t)
+	if err != nil {
+		writeStoreError(w, err)
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
+	w.Header().Set("ETag", etag(t))
+	writeJSON(w, http.StatusOK, t)
+}
+
+// DeleteTask handles DELETE requests on /tasks/{id}.
+// Return 204 if the task could be deleted
+// Return 404 when the task ID is invalid or does not exist
+// Return 412 when the If-Match header does not match the ETag of the task
+// Return 409 or 500 depending on the error returned by the datastore
+func (s *Server) DeleteTask(w http.ResponseWriter, r *http.Request) {
+	id, err := taskID(r)
+	if err != nil {
+		writeStoreError(w, store.ErrTaskNotFound)
+		return
+	}
+
+	current, err := s.current(r, id)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	if err := s.store.DeleteTask(id, current.Version); err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writeJSON replies with the value encoded as JSON
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	j, _ := json.Marshal(v)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(j)
 }
 
-func validateTask(t model.Task) error {
+// taskID extracts the task ID from the {id} parameter of the request path
+func taskID(r *http.Request) (int, error) {
+	return strconv.Atoi(router.Param(r, "id"))
+}
+
+func (s *Server) parseQuery(r *http.Request) (model.Query, error) {
+	v := r.URL.Query()
+	q := model.Query{Status: model.Status(strings.ToUpper(v.Get("status")))}
+	if q.Status != "" && !s.workflow.Valid(q.Status) {
+		return q, invalidField("status", "invalid", "Invalid status")
+	}
+
+	if val := v.Get("due_before"); val != "" {
+		due, err := time.Parse(time.RFC3339, val)
+		if err != nil {
+			return q, invalidField("due_before", "invalid", "Invalid due_before")
+		}
+		q.DueBefore = due
+	}
+
+	if val := v.Get("due_within"); val != "" {
+		window, err := time.ParseDuration(val)
+		if err != nil || window <= 0 {
+			return q, invalidField("due_within", "invalid", "Invalid due_within")
+		}
+		q.DueAfter, q.DueBefore, q.Open = s.now(), s.now().Add(window), true
+	}
+
+	if val := v.Get("overdue"); val != "" {
+		overdue, err := strconv.ParseBool(val)
+		if err != nil {
+			return q, invalidField("overdue", "invalid", "Invalid overdue")
+		}
+		if overdue {
+			q.DueBefore, q.Open = s.now(), true
+		}
+	}
+
+	if val := v.Get("ready"); val != "" {
+		ready, err := strconv.ParseBool(val)
+		if err != nil {
+			return q, invalidField("ready", "invalid", "Invalid ready")
+		}
+		q.Ready = ready
+	}
+
+	if q.Assignee = v.Get("assignee"); q.Assignee == "me" {
+		p, ok := auth.FromContext(r.Context())
+		if !ok {
+			return q, invalidField("assignee", "invalid", "assignee=me requires an authenticated request")
+		}
+		q.Assignee = p.Subject
+	}
+
+	for _, tag := range v["tag"] {
+		switch {
+		case strings.HasPrefix(tag, "!") && validTag(tag[1:]):
+			q.NotTags = append(q.NotTags, tag[1:])
+		case validTag(tag):
+			q.Tags = append(q.Tags, tag)
+		default:
+			return q, invalidField("tag", "invalid", "Invalid tag")
+		}
+	}
+
+	var desc bool
+	switch v.Get("order") {
+	case "", "asc":
+	case "desc":
+		desc = true
+	default:
+		return q, invalidField("order", "invalid", "Invalid order")
+	}
+
+	for _, val := range v["sort"] {
+		for _, field := range strings.Split(val, ",") {
+			k := model.SortKey{Field: field, Desc: desc}
+			if strings.HasPrefix(field, "-") {
+				k = model.SortKey{Field: field[1:], Desc: true}
+			}
+			if !model.IsSortField(k.Field) {
+				return q, invalidField("sort", "invalid", "Invalid sort field")
+			}
+			q.Sort = append(q.Sort, k)
+		}
+	}
+
+	return q, nil
+}
+
+// validateTask reports every invalid field of the task at once
+func (s *Server) validateTask(t model.Task) error {
+	var errs ValidationError
 	if t.Title == "" {
-		return errors.New("Title is missing")
+		errs = append(errs, FieldError{Field: "title", Code: "required", Detail: "Title is missing"})
+	}
+	if !s.workflow.Valid(t.Status) {
+		errs = append(errs, FieldError{Field: "status", Code: "invalid", Detail: "Invalid status"})
+	}
+	if t.Priority < s.settings.MinPriority || t.Priority > s.settings.MaxPriority {
+		errs = append(errs, FieldError{Field: "priority", Code: "out_of_range", Detail: "Invalid priority number"})
+	}
+	if t.Due != nil && t.Due.IsZero() {
+		errs = append(errs, FieldError{Field: "due", Code: "invalid", Detail: "Invalid due date"})
 	}
-	if t.Status != "DONE" && t.Status != "DOING" && t.Status != "PENDING" {
-		return errors.New("Invalid status")
+	for _, tag := range t.Tags {
+		if !validTag(tag) {
+			errs = append(errs, FieldError{Field: "tags", Code: "invalid", Detail: "Invalid tag"})
+			break
+		}
 	}
-	if t.Priority == 0 || t.Priority > 10 {
-		return errors.New("Invalid priority number")
+	if t.Parent < 0 {
+		errs = append(errs, FieldError{Field: "parent", Code: "invalid", Detail: "Invalid parent"})
+	}
+	if t.Recurrence != nil {
+		if err := t.Recurrence.Validate(); err != nil {
+			errs = append(errs, FieldError{Field: "recurrence", Code: "invalid", Detail: "Invalid recurrence: " + err.Error()})
+		} else if t.Due == nil {
+			errs = append(errs, FieldError{Field: "due", Code: "required", Detail: "Due date is missing for a recurring task"})
+		}
+	}
+	for _, id := range t.BlockedBy {
+		if id <= 0 {
+			errs = append(errs, FieldError{Field: "blocked_by", Code: "invalid", Detail: "Invalid blocker"})
+			break
+		}
+	}
+	ids := make(map[int]bool)
+	for _, item := range t.Checklist {
+		if item.Text == "" || item.ID < 0 || item.ID != 0 && ids[item.ID] {
+			errs = append(errs, FieldError{Field: "checklist", Code: "invalid", Detail: "Invalid checklist item"})
+			break
+		}
+		ids[item.ID] = true
+	}
+	if errs != nil {
+		return errs
 	}
 	return nil
 }
+
+// validTag returns true if the tag is not empty and can not be mistaken
+// for an excluded tag or a list of tags in a query
+func validTag(tag string) bool {
+	return tag != "" && !strings.HasPrefix(tag, "!") && !strings.ContainsAny(tag, ", \t\n")
+}
+
+func invalidField(field, code, detail string) error {
+	return ValidationError{{Field: field, Code: code, Detail: detail}}
+}
@@ -2,99 +2,138 @@ package server
 
 import (
 	"bytes"
+	"encoding/json"
 	"errors"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
 	"testing"
+	"time"
 
 	"github.com/toversus/tbdist/model"
 	"github.com/toversus/tbdist/store"
 )
 
 type mockedStore struct {
-	GetTaskFunc  func() model.Tasks
-	SaveTaskFunc func(task model.Task) error
+	FindTaskFunc   func(id int) (model.Task, error)
+	FindTasksFunc  func(q model.Query) model.Tasks
+	SaveTaskFunc   func(task model.Task) error
+	DeleteTaskFunc func(id int, version int) error
 }
 
-func (ms *mockedStore) GetPendingTasks() model.Tasks {
+func (ms *mockedStore) GetTasksByStatus(status model.Status) model.Tasks {
 	return model.Tasks{
-		{ID: 1, Title: "go to school", Status: "PENDING", Priority: 1},
-		{ID: 2, Title: "withdraw my money", Status: "PENDING", Priority: 10},
+		{ID: 1, Title: "go to school", Status: status, Priority: 1},
+		{ID: 2, Title: "withdraw my money", Status: status, Priority: 10},
 	}
 }
 
-func (ms *mockedStore) GetDoingTasks() model.Tasks {
-	return model.Tasks{
-		{ID: 1, Title: "go to school", Status: "DOING", Priority: 1},
-		{ID: 2, Title: "withdraw my money", Status: "DOING", Priority: 10},
+func (ms *mockedStore) FindTasks(q model.Query) model.Tasks {
+	if ms.FindTasksFunc != nil {
+		return ms.FindTasksFunc(q)
 	}
+	return nil
 }
 
-func (ms *mockedStore) GetDoneTasks() model.Tasks {
-	return model.Tasks{
-		{ID: 1, Title: "go to school", Status: "DONE", Priority: 1},
-		{ID: 2, Title: "withdraw my money", Status: "DONE", Priority: 10},
-	}
+func (ms *mockedStore) GetBlockers(id int) (model.Tasks, error) {
+	return nil, nil
 }
 
-func (ms *mockedStore) GetPendingTasksSortedByPriority() model.Tasks {
-	return model.Tasks{
-		{ID: 1, Title: "go to school", Status: "PENDING", Priority: 1},
-		{ID: 2, Title: "withdraw my money", Status: "PENDING", Priority: 10},
-		{ID: 3, Title: "go shopping", Status: "PENDING", Priority: 5},
+func (ms *mockedStore) GetTags() map[string]int {
+	return map[string]int{"backend": 2, "frontend": 1}
+}
+
+func (ms *mockedStore) GetTask(id int) (model.Task, error) {
+	if ms.FindTaskFunc != nil {
+		return ms.FindTaskFunc(id)
 	}
+	return model.Task{ID: id, Title: "go to school", Status: "DOING", Priority: 1}, nil
 }
 
-func (ms *mockedStore) SaveTask(task model.Task) error {
+func (ms *mockedStore) SaveTask(task model.Task) (model.Task, error) {
 	if ms.SaveTaskFunc != nil {
-		return ms.SaveTaskFunc(task)
+		if err := ms.SaveTaskFunc(task); err != nil {
+			return model.Task{}, err
+		}
+	}
+	if task.ID == 0 {
+		task.ID = 1
+	}
+	return task, nil
+}
+
+func (ms *mockedStore) SaveTasks(tasks model.Tasks) (model.Tasks, error) {
+	for i, task := range tasks {
+		t, err := ms.SaveTask(task)
+		if err != nil {
+			return nil, err
+		}
+		tasks[i] = t
+	}
+	return tasks, nil
+}
+
+func (ms *mockedStore) DeleteTask(id int, version int) error {
+	if ms.DeleteTaskFunc != nil {
+		return ms.DeleteTaskFunc(id, version)
 	}
 	return nil
 }
 
 var getTaskTests = []struct {
-	name    string
-	getFunc func() model.Tasks
-	getTask func(w http.ResponseWriter, r *http.Request)
-	expect  string
+	name   string
+	url    string
+	code   int
+	expect string
 }{
 	{
-		name:    "should return pending tasks as JSON",
-		getTask: GetPendingTasks,
-		expect:  "[{\"id\":1,\"title\":\"go to school\",\"status\":\"PENDING\",\"priority\":1},{\"id\":2,\"title\":\"withdraw my money\",\"status\":\"PENDING\",\"priority\":10}]",
+		name:   "should return pending tasks as JSON",
+		url:    "/tasks/pending",
+		code:   http.StatusOK,
+		expect: "[{\"id\":1,\"title\":\"go to school\",\"status\":\"PENDING\",\"priority\":1},{\"id\":2,\"title\":\"withdraw my money\",\"status\":\"PENDING\",\"priority\":10}]",
+	},
+	{
+		name:   "should return tasks in progress as JSON",
+		url:    "/tasks/doing",
+		code:   http.StatusOK,
+		expect: "[{\"id\":1,\"title\":\"go to school\",\"status\":\"DOING\",\"priority\":1},{\"id\":2,\"title\":\"withdraw my money\",\"status\":\"DOING\",\"priority\":10}]",
+	},
+	{
+		name:   "should return completed tasks as JSON",
+		url:    "/tasks/done",
+		code:   http.StatusOK,
+		expect: "[{\"id\":1,\"title\":\"go to school\",\"status\":\"DONE\",\"priority\":1},{\"id\":2,\"title\":\"withdraw my money\",\"status\":\"DONE\",\"priority\":10}]",
 	},
 	{
-		name:    "should return tasks in progress as JSON",
-		getTask: GetDoingTasks,
-		expect:  "[{\"id\":1,\"title\":\"go to school\",\"status\":\"DOING\",\"priority\":1},{\"id\":2,\"title\":\"withdraw my money\",\"status\":\"DOING\",\"priority\":10}]",
+		name:   "should return blocked tasks of a custom workflow as JSON",
+		url:    "/tasks/blocked",
+		code:   http.StatusOK,
+		expect: "[{\"id\":1,\"title\":\"go to school\",\"status\":\"BLOCKED\",\"priority\":1},{\"id\":2,\"title\":\"withdraw my money\",\"status\":\"BLOCKED\",\"priority\":10}]",
 	},
 	{
-		name:    "should return completed tasks as JSON",
-		getTask: GetDoneTasks,
-		expect:  "[{\"id\":1,\"title\":\"go to school\",\"status\":\"DONE\",\"priority\":1},{\"id\":2,\"title\":\"withdraw my money\",\"status\":\"DONE\",\"priority\":10}]",
+		name:   "should response with a status 404 Not Found for a status out of the workflow",
+		url:    "/tasks/hoge",
+		code:   http.StatusNotFound,
+		expect: "{\"type\":\"about:blank\",\"title\":\"Not Found\",\"status\":404,\"detail\":\"Status was not found\",\"code\":\"status_not_found\"}",
 	},
 }
 
-func TestGetPendingTasks(t *testing.T) {
-	t.Log("getting pending tasks...")
+func TestGetTasksByStatus(t *testing.T) {
+	t.Log("getting tasks by status...")
+
+	workflow := model.DefaultWorkflow
+	workflow.Statuses = append([]model.Status{"BLOCKED"}, workflow.Statuses...)
 
 	for _, testcase := range getTaskTests {
 		t.Log(testcase.name)
 
 		rec := httptest.NewRecorder()
-		req, _ := http.NewRequest(http.MethodGet, "/tasks/pending", nil)
+		req, _ := http.NewRequest(http.MethodGet, testcase.url, nil)
 
-		// The datastore is restored at the end of the test
-		defer func() { ds = &store.Datastore{} }()
+		New(&mockedStore{}, WithWorkflow(workflow)).ServeHTTP(rec, req)
 
-		ds = &mockedStore{
-			GetTaskFunc: testcase.getFunc,
-		}
-
-		testcase.getTask(rec, req)
-
-		if rec.Code != http.StatusOK {
-			t.Errorf("KO => Got %d expected %d", rec.Code, http.StatusOK)
+		if rec.Code != testcase.code {
+			t.Errorf("KO => Got %d expected %d", rec.Code, testcase.code)
 		}
 		if result := rec.Body.String(); result != testcase.expect {
 			t.Errorf("KO => Got %s expected %s", result, testcase.expect)
@@ -102,39 +141,193 @@ func TestGetPendingTasks(t *testing.T) {
 	}
 }
 
-var getTaskSortedByPriorityTests = []struct {
-	name    string
-	getFunc func() model.Tasks
-	getTask func(w http.ResponseWriter, r *http.Request)
-	expect  string
+var findTasksTests = []struct {
+	name   string
+	url    string
+	code   int
+	expect model.Query
 }{
 	{
-		name:    "should return pending tasks sorted by prioriey as JSON",
-		getTask: GetPendingTasksSortedByPriority,
-		expect:  "[{\"id\":1,\"title\":\"go to school\",\"status\":\"PENDING\",\"priority\":1},{\"id\":3,\"title\":\"go shopping\",\"status\":\"PENDING\",\"priority\":5},{\"id\":2,\"title\":\"withdraw my money\",\"status\":\"PENDING\",\"priority\":10}]",
+		name:   "should list every task without query parameters",
+		url:    "/tasks",
+		code:   http.StatusOK,
+		expect: model.Query{},
+	},
+	{
+		name:   "should filter tasks by status",
+		url:    "/tasks?status=pending",
+		code:   http.StatusOK,
+		expect: model.Query{Status: "PENDING"},
+	},
+	{
+		name: "should sort tasks by several keys",
+		url:  "/tasks?status=DOING&sort=-priority,id&sort=title",
+		code: http.StatusOK,
+		expect: model.Query{
+			Status: "DOING",
+			Sort: []model.SortKey{
+				{Field: "priority", Desc: true},
+				{Field: "id"},
+				{Field: "title"},
+			},
+		},
+	},
+	{
+		name: "should apply order to the keys without prefix",
+		url:  "/tasks?sort=priority,-id&order=desc",
+		code: http.StatusOK,
+		expect: model.Query{
+			Sort: []model.SortKey{
+				{Field: "priority", Desc: true},
+				{Field: "id", Desc: true},
+			},
+		},
+	},
+	{
+		name:   "should list tasks due before the given time",
+		url:    "/tasks?due_before=2026-10-20T09:00:00Z",
+		code:   http.StatusOK,
+		expect: model.Query{DueBefore: time.Date(2026, 10, 20, 9, 0, 0, 0, time.UTC)},
+	},
+	{
+		name: "should list open tasks due within the given window",
+		url:  "/tasks?due_within=48h&sort=due",
+		code: http.StatusOK,
+		expect: model.Query{
+			DueAfter:  time.Date(2026, 10, 18, 9, 0, 0, 0, time.UTC),
+			DueBefore: time.Date(2026, 10, 20, 9, 0, 0, 0, time.UTC),
+			Open:      true,
+			Sort:      []model.SortKey{{Field: "due"}},
+		},
+	},
+	{
+		name:   "should list overdue tasks",
+		url:    "/tasks?overdue=true",
+		code:   http.StatusOK,
+		expect: model.Query{DueBefore: time.Date(2026, 10, 18, 9, 0, 0, 0, time.UTC), Open: true},
+	},
+	{
+		name:   "should list tasks with and without tags",
+		url:    "/tasks?tag=backend&tag=!blocked&tag=api",
+		code:   http.StatusOK,
+		expect: model.Query{Tags: []string{"backend", "api"}, NotTags: []string{"blocked"}},
+	},
+	{
+		name:   "should list tasks ready to be started",
+		url:    "/tasks?ready=true",
+		code:   http.StatusOK,
+		expect: model.Query{Ready: true},
+	},
+	{
+		name: "should response with a status 400 Bad Request when ready is invalid",
+		url:  "/tasks?ready=hoge",
+		code: http.StatusBadRequest,
+	},
+	{
+		name: "should response with a status 400 Bad Request when a tag is empty",
+		url:  "/tasks?tag=!",
+		code: http.StatusBadRequest,
+	},
+	{
+		name: "should response with a status 400 Bad Request when due_before is not RFC 3339",
+		url:  "/tasks?due_before=2026-10-20",
+		code: http.StatusBadRequest,
+	},
+	{
+		name: "should response with a status 400 Bad Request when due_within is invalid",
+		url:  "/tasks?due_within=-1h",
+		code: http.StatusBadRequest,
+	},
+	{
+		name: "should response with a status 400 Bad Request when status is invalid",
+		url:  "/tasks?status=HOGE",
+		code: http.StatusBadRequest,
+	},
+	{
+		name: "should response with a status 400 Bad Request when sort field is invalid",
+		url:  "/tasks?sort=-hoge",
+		code: http.StatusBadRequest,
+	},
+	{
+		name: "should response with a status 400 Bad Request when order is invalid",
+		url:  "/tasks?sort=id&order=up",
+		code: http.StatusBadRequest,
 	},
 }
 
-func TestGetPendingTasksSortedByPriority(t *testing.T) {
-	t.Log("getting pending tasks sorted by priority...")
+func TestGetTasks(t *testing.T) {
+	t.Log("finding tasks...")
 
-	for _, testcase := range getTaskSortedByPriorityTests {
+	clock := func() time.Time { return time.Date(2026, 10, 18, 9, 0, 0, 0, time.UTC) }
+
+	for _, testcase := range findTasksTests {
 		t.Log(testcase.name)
 
 		rec := httptest.NewRecorder()
-		req, _ := http.NewRequest(http.MethodGet, "/tasks/pending?sort=-priority", nil)
+		req, _ := http.NewRequest(http.MethodGet, testcase.url, nil)
+
+		var got model.Query
+		ms := &mockedStore{
+			FindTasksFunc: func(q model.Query) model.Tasks {
+				got = q
+				return nil
+			},
+		}
 
-		// The datastore is restored at the end of the test
-		defer func() { ds = &store.Datastore{} }()
+		New(ms, WithClock(clock)).ServeHTTP(rec, req)
 
-		ds = &mockedStore{
-			GetTaskFunc: testcase.getFunc,
+		if rec.Code != testcase.code {
+			t.Errorf("KO => Got %d expected %d", rec.Code, testcase.code)
 		}
+		if rec.Code == http.StatusOK && !reflect.DeepEqual(got, testcase.expect) {
+			t.Errorf("KO => Got %+v expected %+v", got, testcase.expect)
+		}
+	}
+}
+
+var getSingleTaskTests = []struct {
+	name     string
+	findFunc func(id int) (model.Task, error)
+	url      string
+	code     int
+	expect   string
+}{
+	{
+		name:   "should return the task as JSON",
+		url:    "/tasks/1",
+		code:   http.StatusOK,
+		expect: "{\"id\":1,\"title\":\"go to school\",\"status\":\"DOING\",\"priority\":1}",
+	},
+	{
+		name: "should response with a status 404 Not Found when the task does not exist",
+		findFunc: func(id int) (model.Task, error) {
+			return model.Task{}, store.ErrTaskNotFound
+		},
+		url:    "/tasks/2",
+		code:   http.StatusNotFound,
+		expect: "{\"type\":\"about:blank\",\"title\":\"Not Found\",\"status\":404,\"detail\":\"Task was not found\",\"code\":\"task_not_found\"}",
+	},
+	{
+		name:   "should response with a status 404 Not Found when the task ID is neither a number nor a status",
+		url:    "/tasks/a",
+		code:   http.StatusNotFound,
+		expect: "{\"type\":\"about:blank\",\"title\":\"Not Found\",\"status\":404,\"detail\":\"Status was not found\",\"code\":\"status_not_found\"}",
+	},
+}
+
+func TestGetTask(t *testing.T) {
+	t.Log("getting a single task...")
 
-		testcase.getTask(rec, req)
+	for _, testcase := range getSingleTaskTests {
+		t.Log(testcase.name)
 
-		if rec.Code != http.StatusOK {
-			t.Errorf("KO => Got %d expected %d", rec.Code, http.StatusOK)
+		rec := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, testcase.url, nil)
+
+		New(&mockedStore{FindTaskFunc: testcase.findFunc}).ServeHTTP(rec, req)
+
+		if rec.Code != testcase.code {
+			t.Errorf("KO => Got %d expected %d", rec.Code, testcase.code)
 		}
 		if result := rec.Body.String(); result != testcase.expect {
 			t.Errorf("KO => Got %s expected %s", result, testcase.expect)
@@ -166,6 +359,14 @@ var addTaskTests = []struct {
 		body:   []byte(`["Title":"buy bread for breakfast."]`),
 		expect: http.StatusBadRequest,
 	},
+	{
+		name: "should response internal error when datastore returns an unexpected error",
+		saveFunc: func(task model.Task) error {
+			return errors.New("datastore error")
+		},
+		body:   []byte(`{"Title":"buy bread for breakfast.","Status":"DOING","Priority":1}`),
+		expect: http.StatusInternalServerError,
+	},
 	{
 		name:   "should response bad argument when task title is empty",
 		body:   []byte(`["Title":""]`),
@@ -176,6 +377,51 @@ var addTaskTests = []struct {
 		body:   []byte(`["Title":"buy bread for breakfast.","Status":"HOGE","Priority":1]`),
 		expect: http.StatusBadRequest,
 	},
+	{
+		name:   "should add new task with a deadline",
+		body:   []byte(`{"Title":"buy bread for breakfast.","Status":"DOING","Priority":1,"due":"2026-10-20T09:00:00+09:00"}`),
+		expect: http.StatusCreated,
+	},
+	{
+		name:   "should response bad argument when task deadline is not RFC 3339",
+		body:   []byte(`{"Title":"buy bread for breakfast.","Status":"DOING","Priority":1,"due":"2026-10-20"}`),
+		expect: http.StatusBadRequest,
+	},
+	{
+		name:   "should response bad argument when task deadline is zero",
+		body:   []byte(`{"Title":"buy bread for breakfast.","Status":"DOING","Priority":1,"due":"0001-01-01T00:00:00Z"}`),
+		expect: http.StatusBadRequest,
+	},
+	{
+		name:   "should add new task with tags",
+		body:   []byte(`{"Title":"buy bread for breakfast.","Status":"DOING","Priority":1,"tags":["home","shopping"]}`),
+		expect: http.StatusCreated,
+	},
+	{
+		name:   "should response bad argument when a task tag starts with !",
+		body:   []byte(`{"Title":"buy bread for breakfast.","Status":"DOING","Priority":1,"tags":["!home"]}`),
+		expect: http.StatusBadRequest,
+	},
+	{
+		name:   "should add new recurring task",
+		body:   []byte(`{"Title":"rotate on-call","Status":"PENDING","Priority":1,"due":"2026-10-19T09:00:00Z","recurrence":{"freq":"weekly","by_day":["MO"]}}`),
+		expect: http.StatusCreated,
+	},
+	{
+		name:   "should response bad argument when a recurring task has no deadline",
+		body:   []byte(`{"Title":"rotate on-call","Status":"PENDING","Priority":1,"recurrence":{"freq":"daily"}}`),
+		expect: http.StatusBadRequest,
+	},
+	{
+		name:   "should response bad argument when the recurrence is invalid",
+		body:   []byte(`{"Title":"rotate on-call","Status":"PENDING","Priority":1,"due":"2026-10-19T09:00:00Z","recurrence":{"freq":"daily","by_day":["MO"]}}`),
+		expect: http.StatusBadRequest,
+	},
+	{
+		name:   "should response bad argument when the recurrence interval is too large",
+		body:   []byte(`{"Title":"rotate on-call","Status":"PENDING","Priority":1,"due":"2026-10-19T09:00:00Z","recurrence":{"freq":"weekly","interval":100000000,"by_day":["MO"]}}`),
+		expect: http.StatusBadRequest,
+	},
 	{
 		name:   "should response bad argument when task priority is invalid",
 		body:   []byte(`["Title":"buy bread for breakfast.","Status":"DOING","Priority":100]`),
@@ -192,13 +438,7 @@ func TestAddTask(t *testing.T) {
 		rec := httptest.NewRecorder()
 		req, _ := http.NewRequest(http.MethodPost, "/tasks", bytes.NewBuffer(testcase.body))
 
-		defer func() { ds = &store.Datastore{} }()
-
-		ds = &mockedStore{
-			SaveTaskFunc: testcase.saveFunc,
-		}
-
-		AddTask(rec, req)
+		New(&mockedStore{SaveTaskFunc: testcase.saveFunc}).ServeHTTP(rec, req)
 
 		if rec.Code != testcase.expect {
 			t.Errorf("KO => Got %d expected %d", rec.Code, testcase.expect)
@@ -217,18 +457,45 @@ var updateTaskTests = []struct {
 		body:   []byte(`{"ID":1, "Title":"buy bread for breakfast.", "Status":"DONE", "Priority":1}`),
 		expect: http.StatusOK,
 	},
+	{
+		name: "should use the task ID of the path rather than the one of the body",
+		saveFunc: func(task model.Task) error {
+			if task.ID != 1 {
+				return store.ErrTaskNotFound
+			}
+			return nil
+		},
+		body:   []byte(`{"ID":2, "Title":"buy bread for breakfast.", "Status":"DONE", "Priority":1}`),
+		expect: http.StatusOK,
+	},
 	{
 		name:   "should response with a statu 400 Bad Request when JSON body could not be handled",
 		body:   []byte(""),
 		expect: http.StatusBadRequest,
 	},
 	{
-		name: "should response with a statu 400 Bad Request when the datastore returned an error",
+		name: "should response with a status 500 Internal Server Error when the datastore returned an error",
 		saveFunc: func(task model.Task) error {
 			return errors.New("datastore error")
 		},
 		body:   []byte(`{"ID":1, "Title":"buy bread for breakfast.", "Status": "DONE", "Priority":1}`),
-		expect: http.StatusBadRequest,
+		expect: http.StatusInternalServerError,
+	},
+	{
+		name: "should response with a status 404 Not Found when the task does not exist",
+		saveFunc: func(task model.Task) error {
+			return store.ErrTaskNotFound
+		},
+		body:   []byte(`{"Title":"buy bread for breakfast.", "Status": "DONE", "Priority":1}`),
+		expect: http.StatusNotFound,
+	},
+	{
+		name: "should response with a status 409 Conflict when the datastore reported a conflict",
+		saveFunc: func(task model.Task) error {
+			return store.ErrConflict
+		},
+		body:   []byte(`{"Title":"buy bread for breakfast.", "Status": "DONE", "Priority":1}`),
+		expect: http.StatusConflict,
 	},
 	{
 		name:   "should response with a status 400 Bad Request when task title is empty",
@@ -241,21 +508,377 @@ func TestUpdateTask(t *testing.T) {
 	t.Log("updating task...")
 
 	for _, testcase := range updateTaskTests {
-		t.Logf(testcase.name)
+		t.Log(testcase.name)
 
 		rec := httptest.NewRecorder()
-		req, _ := http.NewRequest(http.MethodPost, "/tasks/1", bytes.NewBuffer(testcase.body))
+		req, _ := http.NewRequest(http.MethodPut, "/tasks/1", bytes.NewBuffer(testcase.body))
 
-		defer func() { ds = &store.Datastore{} }()
+		New(&mockedStore{SaveTaskFunc: testcase.saveFunc}).ServeHTTP(rec, req)
 
-		ds = &mockedStore{
-			SaveTaskFunc: testcase.saveFunc,
+		if rec.Code != testcase.expect {
+			t.Errorf("KO => Got %d expected %d", rec.Code, testcase.expect)
 		}
+	}
+}
+
+var deleteTaskTests = []struct {
+	name       string
+	deleteFunc func(id int, version int) error
+	url        string
+	expect     int
+}{
+	{
+		name:   "should response with a status 204 No Content when the task was deleted",
+		url:    "/tasks/1",
+		expect: http.StatusNoContent,
+	},
+	{
+		name: "should response with a status 404 Not Found when the task does not exist",
+		deleteFunc: func(id int, version int) error {
+			return store.ErrTaskNotFound
+		},
+		url:    "/tasks/2",
+		expect: http.StatusNotFound,
+	},
+	{
+		name:   "should response with a status 405 Method Not Allowed when the task ID is not a number",
+		url:    "/tasks/a",
+		expect: http.StatusMethodNotAllowed,
+	},
+}
 
-		UpdateTask(rec, req)
+func TestDeleteTask(t *testing.T) {
+	t.Log("deleting task...")
+
+	for _, testcase := range deleteTaskTests {
+		t.Log(testcase.name)
+
+		rec := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodDelete, testcase.url, nil)
+
+		New(&mockedStore{DeleteTaskFunc: testcase.deleteFunc}).ServeHTTP(rec, req)
 
 		if rec.Code != testcase.expect {
 			t.Errorf("KO => Got %d expected %d", rec.Code, testcase.expect)
 		}
 	}
 }
+
+var createdTaskTests = []struct {
+	name     string
+	method   string
+	url      string
+	body     string
+	code     int
+	location string
+	expect   string
+}{
+	{
+		name:     "should return the created task and its location",
+		method:   http.MethodPost,
+		url:      "/tasks",
+		body:     `{"title":"go to school","status":"PENDING","priority":1}`,
+		code:     http.StatusCreated,
+		location: "/tasks/1",
+		expect:   "{\"id\":1,\"title\":\"go to school\",\"status\":\"PENDING\",\"priority\":1,\"version\":1}",
+	},
+	{
+		name:     "should return the next created task and its location",
+		method:   http.MethodPost,
+		url:      "/tasks",
+		body:     `{"title":"withdraw my money","status":"DOING","priority":3}`,
+		code:     http.StatusCreated,
+		location: "/tasks/2",
+		expect:   "{\"id\":2,\"title\":\"withdraw my money\",\"status\":\"DOING\",\"priority\":3,\"version\":1}",
+	},
+	{
+		name:   "should return the updated task",
+		method: http.MethodPut,
+		url:    "/tasks/1",
+		body:   `{"title":"go to school","status":"DOING","priority":1}`,
+		code:   http.StatusOK,
+		expect: "{\"id\":1,\"title\":\"go to school\",\"status\":\"DOING\",\"priority\":1,\"version\":2}",
+	},
+	{
+		name:     "should create a new task when the body carries the ID of an existing one",
+		method:   http.MethodPost,
+		url:      "/tasks",
+		body:     `{"id":1,"title":"hijacked","status":"PENDING","priority":2,"version":2}`,
+		code:     http.StatusCreated,
+		location: "/tasks/3",
+		expect:   "{\"id\":3,\"title\":\"hijacked\",\"status\":\"PENDING\",\"priority\":2,\"version\":1}",
+	},
+	{
+		name:   "should leave the existing task unchanged",
+		method: http.MethodGet,
+		url:    "/tasks/1",
+		code:   http.StatusOK,
+		expect: "{\"id\":1,\"title\":\"go to school\",\"status\":\"DOING\",\"priority\":1,\"version\":2}",
+	},
+}
+
+func TestCreatedTask(t *testing.T) {
+	t.Log("returning saved tasks...")
+
+	s := New(&store.Datastore{})
+
+	for _, testcase := range createdTaskTests {
+		t.Log(testcase.name)
+
+		rec := httptest.NewRecorder()
+		req, _ := http.NewRequest(testcase.method, testcase.url, bytes.NewBufferString(testcase.body))
+
+		s.ServeHTTP(rec, req)
+
+		if rec.Code != testcase.code {
+			t.Errorf("KO => Got %d expected %d", rec.Code, testcase.code)
+		}
+		if location := rec.Header().Get("Location"); location != testcase.location {
+			t.Errorf("KO => Got %s expected %s", location, testcase.location)
+		}
+		if result := rec.Body.String(); result != testcase.expect {
+			t.Errorf("KO => Got %s expected %s", result, testcase.expect)
+		}
+	}
+}
+
+var problemTests = []struct {
+	name   string
+	method string
+	url    string
+	body   string
+	expect Problem
+}{
+	{
+		name:   "should report every invalid field of the task",
+		method: http.MethodPost,
+		url:    "/tasks",
+		body:   `{"title":"","status":"HOGE","priority":100}`,
+		expect: Problem{
+			Type:   "about:blank",
+			Title:  "Bad Request",
+			Status: http.StatusBadRequest,
+			Detail: "Title is missing, Invalid status, Invalid priority number",
+			Code:   CodeInvalidTask,
+			Errors: []FieldError{
+				{Field: "title", Code: "required", Detail: "Title is missing"},
+				{Field: "status", Code: "invalid", Detail: "Invalid status"},
+				{Field: "priority", Code: "out_of_range", Detail: "Invalid priority number"},
+			},
+		},
+	},
+	{
+		name:   "should report the invalid query parameter",
+		method: http.MethodGet,
+		url:    "/tasks?sort=hoge",
+		expect: Problem{
+			Type:   "about:blank",
+			Title:  "Bad Request",
+			Status: http.StatusBadRequest,
+			Detail: "Invalid sort field",
+			Code:   CodeInvalidQuery,
+			Errors: []FieldError{
+				{Field: "sort", Code: "invalid", Detail: "Invalid sort field"},
+			},
+		},
+	},
+	{
+		name:   "should report a body that is not JSON",
+		method: http.MethodPut,
+		url:    "/tasks/1",
+		body:   `hoge`,
+		expect: Problem{
+			Type:   "about:blank",
+			Title:  "Bad Request",
+			Status: http.StatusBadRequest,
+			Detail: "invalid character 'h' looking for beginning of value",
+			Code:   CodeInvalidJSON,
+		},
+	},
+}
+
+func TestProblem(t *testing.T) {
+	t.Log("reporting problems...")
+
+	for _, testcase := range problemTests {
+		t.Log(testcase.name)
+
+		rec := httptest.NewRecorder()
+		req, _ := http.NewRequest(testcase.method, testcase.url, bytes.NewBufferString(testcase.body))
+
+		New(&mockedStore{}).ServeHTTP(rec, req)
+
+		if ct := rec.Header().Get("Content-Type"); ct != "application/problem+json" {
+			t.Errorf("KO => Got %s expected application/problem+json", ct)
+		}
+		var p Problem
+		if err := json.NewDecoder(rec.Body).Decode(&p); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(p, testcase.expect) {
+			t.Errorf("KO => Got %+v expected %+v", p, testcase.expect)
+		}
+	}
+}
+
+func TestGetTags(t *testing.T) {
+	t.Log("getting tags...")
+
+	rec := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/tags", nil)
+
+	New(&mockedStore{}).ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Errorf("KO => Got %d expected %d", rec.Code, http.StatusOK)
+	}
+	if result, expect := rec.Body.String(), `{"backend":2,"frontend":1}`; result != expect {
+		t.Errorf("KO => Got %s expected %s", result, expect)
+	}
+}
+
+var hierarchyTests = []struct {
+	name   string
+	url    string
+	code   int
+	expect string
+}{
+	{
+		name:   "should return the direct children of a task",
+		url:    "/tasks/1/children",
+		code:   http.StatusOK,
+		expect: `[{"id":2,"title":"write notes","status":"DOING","priority":1,"parent":1,"version":1},{"id":4,"title":"tag the commit","status":"PENDING","priority":1,"parent":1,"version":1}]`,
+	},
+	{
+		name:   "should response with a status 404 Not Found when the parent does not exist",
+		url:    "/tasks/5/children",
+		code:   http.StatusNotFound,
+		expect: `{"type":"about:blank","title":"Not Found","status":404,"detail":"Task was not found","code":"task_not_found"}`,
+	},
+	{
+		name:   "should nest the tasks under their parent",
+		url:    "/tasks?tree=true",
+		code:   http.StatusOK,
+		expect: `[{"id":1,"title":"release","status":"DOING","priority":1,"version":1,"children":[{"id":2,"title":"write notes","status":"DOING","priority":1,"parent":1,"version":1,"children":[{"id":3,"title":"list changes","status":"DONE","priority":1,"parent":2,"version":1}]},{"id":4,"title":"tag the commit","status":"PENDING","priority":1,"parent":1,"version":1}]}]`,
+	},
+	{
+		name:   "should nest the open tasks under their open parent",
+		url:    "/tasks?tree=true&status=doing",
+		code:   http.StatusOK,
+		expect: `[{"id":1,"title":"release","status":"DOING","priority":1,"version":1,"children":[{"id":2,"title":"write notes","status":"DOING","priority":1,"parent":1,"version":1}]}]`,
+	},
+	{
+		name:   "should response with a status 400 Bad Request when tree is invalid",
+		url:    "/tasks?tree=hoge",
+		code:   http.StatusBadRequest,
+		expect: `{"type":"about:blank","title":"Bad Request","status":400,"detail":"Invalid tree","code":"invalid_query","errors":[{"field":"tree","code":"invalid","detail":"Invalid tree"}]}`,
+	},
+}
+
+func TestHierarchy(t *testing.T) {
+	t.Log("getting subtasks...")
+
+	ds := &store.Datastore{}
+	ds.SaveTask(model.Task{Title: "release", Status: "DOING", Priority: 1})
+	ds.SaveTask(model.Task{Title: "write notes", Status: "DOING", Priority: 1, Parent: 1})
+	ds.SaveTask(model.Task{Title: "list changes", Status: "DONE", Priority: 1, Parent: 2})
+	ds.SaveTask(model.Task{Title: "tag the commit", Status: "PENDING", Priority: 1, Parent: 1})
+
+	for _, testcase := range hierarchyTests {
+		t.Log(testcase.name)
+
+		rec := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, testcase.url, nil)
+
+		New(ds).ServeHTTP(rec, req)
+
+		if rec.Code != testcase.code {
+			t.Errorf("KO => Got %d expected %d", rec.Code, testcase.code)
+		}
+		if result := rec.Body.String(); result != testcase.expect {
+			t.Errorf("KO => Got %s expected %s", result, testcase.expect)
+		}
+	}
+}
+
+var dependencyTests = []struct {
+	name   string
+	url    string
+	code   int
+	expect string
+}{
+	{
+		name:   "should return the blockers of a task",
+		url:    "/tasks/4/blockers",
+		code:   http.StatusOK,
+		expect: `[{"id":1,"title":"design","status":"DONE","priority":3,"version":1},{"id":3,"title":"build","status":"PENDING","priority":2,"blocked_by":[1],"version":1}]`,
+	},
+	{
+		name:   "should response with a status 404 Not Found when the blocked task does not exist",
+		url:    "/tasks/6/blockers",
+		code:   http.StatusNotFound,
+		expect: `{"type":"about:blank","title":"Not Found","status":404,"detail":"Task was not found","code":"task_not_found"}`,
+	},
+	{
+		name:   "should order the tasks after their blockers then by priority",
+		url:    "/tasks/order",
+		code:   http.StatusOK,
+		expect: `[{"id":2,"title":"announce","status":"PENDING","priority":1,"version":1},{"id":5,"title":"review","status":"PENDING","priority":2,"version":1},{"id":1,"title":"design","status":"DONE","priority":3,"version":1},{"id":3,"title":"build","status":"PENDING","priority":2,"blocked_by":[1],"version":1},{"id":4,"title":"ship","status":"PENDING","priority":1,"blocked_by":[1,3],"version":1}]`,
+	},
+}
+
+func TestDependencies(t *testing.T) {
+	t.Log("ordering blocked tasks...")
+
+	ds := &store.Datastore{}
+	ds.SaveTask(model.Task{Title: "design", Status: "DONE", Priority: 3})
+	ds.SaveTask(model.Task{Title: "announce", Status: "PENDING", Priority: 1})
+	ds.SaveTask(model.Task{Title: "build", Status: "PENDING", Priority: 2, BlockedBy: []int{1}})
+	ds.SaveTask(model.Task{Title: "ship", Status: "PENDING", Priority: 1, BlockedBy: []int{3, 1}})
+	ds.SaveTask(model.Task{Title: "review", Status: "PENDING", Priority: 2})
+
+	for _, testcase := range dependencyTests {
+		t.Log(testcase.name)
+
+		rec := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, testcase.url, nil)
+
+		New(ds).ServeHTTP(rec, req)
+
+		if rec.Code != testcase.code {
+			t.Errorf("KO => Got %d expected %d", rec.Code, testcase.code)
+		}
+		if result := rec.Body.String(); result != testcase.expect {
+			t.Errorf("KO => Got %s expected %s", result, testcase.expect)
+		}
+	}
+}
+
+func TestIndependentServers(t *testing.T) {
+	t.Log("running several servers...")
+	t.Parallel()
+
+	a, b := New(&store.Datastore{}), New(&store.Datastore{})
+
+	rec := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodPost, "/tasks", bytes.NewBufferString(`{"title":"go to school","status":"PENDING","priority":1}`))
+	a.ServeHTTP(rec, req)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("KO => Got %d expected %d", rec.Code, http.StatusCreated)
+	}
+
+	for _, testcase := range []struct {
+		server *Server
+		expect string
+	}{
+		{server: a, expect: "[{\"id\":1,\"title\":\"go to school\",\"status\":\"PENDING\",\"priority\":1,\"version\":1}]"},
+		{server: b, expect: "null"},
+	} {
+		rec := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, "/tasks", nil)
+		testcase.server.ServeHTTP(rec, req)
+		if result := rec.Body.String(); result != testcase.expect {
+			t.Errorf("KO => Got %s expected %s", result, testcase.expect)
+		}
+	}
+}
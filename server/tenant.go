@@ -0,0 +1,98 @@
+package server
+
+import (
+	"log"
+	"net/http"
+	"sync"
+
+	"github.com/toversus/tbdist/auth"
+	"github.com/toversus/tbdist/store"
+)
+
+// Tenants defines the partitions of the data per tenant
+type Tenants interface {
+	Tenant(id string) (Store, Projects, error)
+}
+
+// TenantsOf returns the tenants of a registry of the store package
+func TenantsOf(ts *store.Tenants) Tenants {
+	return storeTenants{ts}
+}
+
+// storeTenants adapts store.Tenants to Tenants
+type storeTenants struct {
+	*store.Tenants
+}
+
+// Tenant returns the datastore and the projects of the tenant
+func (st storeTenants) Tenant(id string) (Store, Projects, error) {
+	ds, ps, err := st.Tenants.Tenant(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	return ds, ProjectsOf(ps), nil
+}
+
+// MultiTenant serves each tenant with a server of its own working on
+// the data of the tenant, the tenant is the one of the authenticated
+// principal of the request
+type MultiTenant struct {
+	tenants Tenants
+	auth    Authenticator
+	opts    []Option
+
+	mu      sync.Mutex // mu guards servers
+	servers map[string]*Server
+}
+
+// NewMultiTenant returns a handler serving the tenants, every server
+// is created with the given options
+func NewMultiTenant(tenants Tenants, a Authenticator, opts ...Option) *MultiTenant {
+	return &MultiTenant{
+		tenants: tenants,
+		auth:    a,
+		opts:    opts,
+		servers: make(map[string]*Server),
+	}
+}
+
+// ServeHTTP dispatches the request to the server of its tenant.
+// Return 401 when the credentials are missing, invalid or expired
+// Return 403 when the principal belongs to no tenant
+func (m *MultiTenant) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p, err := m.auth.Authenticate(r)
+	if err != nil {
+		writeAuthError(w, err)
+		return
+	}
+	if p.Tenant == "" {
+		writeProblem(w, http.StatusForbidden, CodeForbidden, "The principal belongs to no tenant")
+		return
+	}
+
+	s, err := m.server(p.Tenant)
+	if err != nil {
+		log.Printf("tenant %s: %v", p.Tenant, err)
+		writeProblem(w, http.StatusInternalServerError, CodeInternalError, "The tenant could not be loaded")
+		return
+	}
+	s.ServeHTTP(w, r.WithContext(auth.WithPrincipal(r.Context(), p)))
+}
+
+// server returns the server of the tenant, creating it on first use
+func (m *MultiTenant) server(id string) (*Server, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if s, ok := m.servers[id]; ok {
+		return s, nil
+	}
+
+	tasks, projects, err := m.tenants.Tenant(id)
+	if err != nil {
+		return nil, err
+	}
+	s := New(tasks, append(m.opts[:len(m.opts):len(m.opts)], WithProjects(projects))...)
+	m.servers[id] = s
+	return s, nil
+}
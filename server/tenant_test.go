@@ -0,0 +1,196 @@
+package server
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/toversus/tbdist/auth"
+	"github.com/toversus/tbdist/model"
+	"github.com/toversus/tbdist/store"
+)
+
+var tenantAuth = auth.New([]auth.Key{
+	{Key: "token-a", Principal: auth.Principal{Subject: "alice", Tenant: "team-a"}},
+	{Key: "token-b", Principal: auth.Principal{Subject: "bob", Tenant: "team-b"}},
+	{Key: "token-admin", Principal: auth.Principal{Subject: "root"}},
+}, tenantSecret)
+
+var tenantSecret = []byte("0123456789abcdef0123456789abcdef")
+
+// isolationTests requests every endpoint as team-b with the IDs of the
+// data of team-a
+var isolationTests = []struct {
+	method string
+	url    string
+	body   string
+	code   int
+	expect string
+}{
+	{method: http.MethodGet, url: "/tasks", code: http.StatusOK, expect: `null`},
+	{method: http.MethodGet, url: "/tasks/1", code: http.StatusNotFound},
+	{method: http.MethodGet, url: "/tasks/order", code: http.StatusOK, expect: `null`},
+	{method: http.MethodGet, url: "/tasks/pending", code: http.StatusOK, expect: `null`},
+	{method: http.MethodPost, url: "/tasks", body: `{"title":"steal","status":"PENDING","priority":1}`, code: http.StatusCreated},
+	{method: http.MethodPut, url: "/tasks/1", body: `{"title":"steal","status":"PENDING","priority":1}`, code: http.StatusNotFound},
+	{method: http.MethodPatch, url: "/tasks/1", body: `{"title":"steal"}`, code: http.StatusNotFound},
+	{method: http.MethodDelete, url: "/tasks/1", code: http.StatusNotFound},
+	{method: http.MethodGet, url: "/tasks/1/children", code: http.StatusNotFound},
+	{method: http.MethodGet, url: "/tasks/1/blockers", code: http.StatusNotFound},
+	{method: http.MethodPost, url: "/tasks/1/checklist", body: `{"text":"steal"}`, code: http.StatusNotFound},
+	{method: http.MethodPut, url: "/tasks/1/checklist/order", body: `[1]`, code: http.StatusNotFound},
+	{method: http.MethodPost, url: "/tasks/1/checklist/1/toggle", code: http.StatusNotFound},
+	{method: http.MethodPost, url: "/tasks/1/start", code: http.StatusNotFound},
+	{method: http.MethodGet, url: "/tags", code: http.StatusOK, expect: `{}`},
+	{method: http.MethodGet, url: "/projects", code: http.StatusOK, expect: `[]`},
+	{method: http.MethodPost, url: "/projects", body: `{"id":"api","name":"Stolen"}`, code: http.StatusCreated},
+	{method: http.MethodGet, url: "/projects/api", code: http.StatusNotFound},
+	{method: http.MethodPut, url: "/projects/api", body: `{"name":"Stolen"}`, code: http.StatusNotFound},
+	{method: http.MethodDelete, url: "/projects/api", code: http.StatusNotFound},
+	{method: http.MethodPost, url: "/projects/api/tasks/1/move", body: `{"project":"web"}`, code: http.StatusNotFound},
+	{method: http.MethodGet, url: "/projects/api/tasks", code: http.StatusNotFound},
+	{method: http.MethodGet, url: "/projects/api/tasks/1", code: http.StatusNotFound},
+	{method: http.MethodGet, url: "/projects/api/tasks/order", code: http.StatusNotFound},
+	{method: http.MethodGet, url: "/projects/api/tasks/pending", code: http.StatusNotFound},
+	{method: http.MethodPost, url: "/projects/api/tasks", body: `{"title":"steal","status":"PENDING","priority":1}`, code: http.StatusNotFound},
+	{method: http.MethodPut, url: "/projects/api/tasks/1", body: `{"title":"steal","status":"PENDING","priority":1}`, code: http.StatusNotFound},
+	{method: http.MethodPatch, url: "/projects/api/tasks/1", body: `{"title":"steal"}`, code: http.StatusNotFound},
+	{method: http.MethodDelete, url: "/projects/api/tasks/1", code: http.StatusNotFound},
+	{method: http.MethodGet, url: "/projects/api/tasks/1/children", code: http.StatusNotFound},
+	{method: http.MethodGet, url: "/projects/api/tasks/1/blockers", code: http.StatusNotFound},
+	{method: http.MethodPost, url: "/projects/api/tasks/1/checklist", body: `{"text":"steal"}`, code: http.StatusNotFound},
+	{method: http.MethodPut, url: "/projects/api/tasks/1/checklist/order", body: `[1]`, code: http.StatusNotFound},
+	{method: http.MethodPost, url: "/projects/api/tasks/1/checklist/1/toggle", code: http.StatusNotFound},
+	{method: http.MethodPost, url: "/projects/api/tasks/1/start", code: http.StatusNotFound},
+	{method: http.MethodGet, url: "/projects/api/tags", code: http.StatusNotFound},
+}
+
+// tenantData returns every task and project of the tenant
+func tenantData(t *testing.T, tenants *store.Tenants, id string) (model.Tasks, []model.Project, []model.Tasks) {
+	tasks, projects, err := tenants.Tenant(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var projectTasks []model.Tasks
+	for _, p := range projects.GetProjects() {
+		ds, _ := projects.Tasks(p.ID)
+		projectTasks = append(projectTasks, ds.FindTasks(model.Query{}))
+	}
+	return tasks.FindTasks(model.Query{}), projects.GetProjects(), projectTasks
+}
+
+func TestTenantIsolation(t *testing.T) {
+	t.Log("isolating tenants...")
+
+	for _, testcase := range isolationTests {
+		t.Log(testcase.method, testcase.url)
+
+		tenants := store.NewTenants()
+		tasks, projects, _ := tenants.Tenant("team-a")
+		tasks.SaveTask(model.Task{Title: "go to school", Status: "PENDING", Priority: 1, Tags: []string{"home"},
+			Checklist: model.Checklist{{Text: "pack the bag"}}})
+		projects.SaveProject(model.Project{ID: "api", Name: "API", Settings: model.DefaultSettings})
+		projects.SaveProject(model.Project{ID: "web", Name: "Web", Settings: model.DefaultSettings})
+		api, _ := projects.Tasks("api")
+		api.SaveTask(model.Task{Title: "fix login", Status: "PENDING", Priority: 1, Checklist: model.Checklist{{Text: "write a test"}}})
+
+		beforeTasks, beforeProjects, beforeProjectTasks := tenantData(t, tenants, "team-a")
+
+		rec := httptest.NewRecorder()
+		req, _ := http.NewRequest(testcase.method, testcase.url, bytes.NewBufferString(testcase.body))
+		req.Header.Set("Authorization", "Bearer token-b")
+		req.Header.Set("Content-Type", mergePatchType)
+
+		NewMultiTenant(TenantsOf(tenants), tenantAuth).ServeHTTP(rec, req)
+
+		if rec.Code != testcase.code {
+			t.Errorf("KO => Got %d expected %d", rec.Code, testcase.code)
+		}
+		if result := rec.Body.String(); testcase.expect != "" && result != testcase.expect {
+			t.Errorf("KO => Got %s expected %s", result, testcase.expect)
+		}
+
+		afterTasks, afterProjects, afterProjectTasks := tenantData(t, tenants, "team-a")
+		if !reflect.DeepEqual(afterTasks, beforeTasks) ||
+			!reflect.DeepEqual(afterProjects, beforeProjects) ||
+			!reflect.DeepEqual(afterProjectTasks, beforeProjectTasks) {
+			t.Errorf("KO => The data of team-a was changed by team-b")
+		}
+	}
+}
+
+var authenticationTests = []struct {
+	name   string
+	header string
+	code   int
+}{
+	{
+		name:   "should serve the tenant of the token",
+		header: "Bearer token-a",
+		code:   http.StatusOK,
+	},
+	{
+		name: "should response with a status 401 Unauthorized without token",
+		code: http.StatusUnauthorized,
+	},
+	{
+		name:   "should response with a status 401 Unauthorized when the token is unknown",
+		header: "Bearer token-c",
+		code:   http.StatusUnauthorized,
+	},
+	{
+		name:   "should response with a status 401 Unauthorized when the token is not a bearer token",
+		header: "token-a",
+		code:   http.StatusUnauthorized,
+	},
+	{
+		name:   "should serve the tenant of a signed token",
+		header: "Bearer " + mustSign(auth.Claims{Subject: "carol", Tenant: "team-b", ExpiresAt: 1 << 40}),
+		code:   http.StatusOK,
+	},
+	{
+		name:   "should response with a status 401 Unauthorized when the signed token has expired",
+		header: "Bearer " + mustSign(auth.Claims{Subject: "carol", Tenant: "team-b", ExpiresAt: 1}),
+		code:   http.StatusUnauthorized,
+	},
+	{
+		name:   "should response with a status 403 Forbidden when the principal belongs to no tenant",
+		header: "Bearer token-admin",
+		code:   http.StatusForbidden,
+	},
+}
+
+func mustSign(c auth.Claims) string {
+	token, err := auth.Sign(c, tenantSecret)
+	if err != nil {
+		panic(err)
+	}
+	return token
+}
+
+func TestTenantAuthentication(t *testing.T) {
+	t.Log("authenticating tenants...")
+
+	m := NewMultiTenant(TenantsOf(store.NewTenants()), tenantAuth)
+	for _, testcase := range authenticationTests {
+		t.Log(testcase.name)
+
+		rec := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, "/tasks", nil)
+		if testcase.header != "" {
+			req.Header.Set("Authorization", testcase.header)
+		}
+
+		m.ServeHTTP(rec, req)
+
+		if rec.Code != testcase.code {
+			t.Errorf("KO => Got %d expected %d", rec.Code, testcase.code)
+		}
+		if rec.Code == http.StatusUnauthorized && rec.Header().Get("WWW-Authenticate") == "" {
+			t.Errorf("KO => Got no WWW-Authenticate header")
+		}
+	}
+}
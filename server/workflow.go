@@ -0,0 +1,98 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/toversus/tbdist/auth"
+	"github.com/toversus/tbdist/model"
+	"github.com/toversus/tbdist/router"
+	"github.com/toversus/tbdist/store"
+)
+
+// TransitionError is returned when the workflow does not allow a task
+// to move from its status to another
+type TransitionError struct {
+	From model.Status
+	To   model.Status
+}
+
+func (e TransitionError) Error() string {
+	return fmt.Sprintf("Task can not move from %s to %s", e.From, e.To)
+}
+
+// errOpenChildren is returned when a task is completed before its children
+// while the parents are strict
+var errOpenChildren = errors.New("Task has children not done yet")
+
+// ApplyAction handles POST requests on /tasks/{id}/{action} where the
+// action names a transition of the workflow such as start, complete or reopen.
+// Return 200 with the modified task as a JSON response and its ETag
+// Return 404 when the task ID is invalid or the task or the action does not exist
+// Return 403 when the caller may not change the task or complete it
+// Return 409 when the workflow does not allow the action from the status of the task
+// or the task would be done before its children
+// Return 412 when the If-Match header does not match the ETag of the task
+func (s *Server) ApplyAction(w http.ResponseWriter, r *http.Request) {
+	id, err := taskID(r)
+	if err != nil {
+		writeStoreError(w, store.ErrTaskNotFound)
+		return
+	}
+
+	action := router.Param(r, "action")
+	transition, ok := s.workflow.Action(action)
+	if !ok {
+		writeProblem(w, http.StatusNotFound, CodeActionNotFound, fmt.Sprintf("Action %s does not exist", action))
+		return
+	}
+
+	t, err := s.current(r, id)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	if t.Status == transition.To {
+		writeStoreError(w, TransitionError{From: t.Status, To: transition.To})
+		return
+	}
+
+	next := t
+	next.Status = transition.To
+	if err := s.checkTransition(r, t, next); err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	t, err = s.store.SaveTask(next)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	w.Header().Set("ETag", etag(t))
+	writeJSON(w, http.StatusOK, t)
+}
+
+// checkTransition returns an error if the workflow does not allow
+// the task to move from its current status to the status of t, if
+// parents are strict and t would be done before its children, or if
+// the caller of the request would complete a task assigned to someone else
+func (s *Server) checkTransition(r *http.Request, current, t model.Task) error {
+	if !s.workflow.Allowed(current.Status, t.Status) {
+		return TransitionError{From: current.Status, To: t.Status}
+	}
+	if t.Status == model.StatusDone && current.Status != model.StatusDone {
+		if p, _ := auth.FromContext(r.Context()); current.Assignee != p.Subject && !s.privileged(r) {
+			return errNotAssignee
+		}
+	}
+	if s.strictParents && t.Status == model.StatusDone && current.Status != model.StatusDone {
+		if open := s.store.FindTasks(model.Query{Parent: t.ID, Open: true}); len(open) > 0 {
+			return errOpenChildren
+		}
+	}
+	return nil
+}
@@ -0,0 +1,259 @@
+package server
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/toversus/tbdist/model"
+	"github.com/toversus/tbdist/store"
+)
+
+var actionTests = []struct {
+	name   string
+	status model.Status
+	method string
+	url    string
+	body   string
+	code   int
+	expect model.Status
+}{
+	{
+		name:   "should start a pending task",
+		status: model.StatusPending,
+		method: http.MethodPost,
+		url:    "/tasks/1/start",
+		code:   http.StatusOK,
+		expect: model.StatusDoing,
+	},
+	{
+		name:   "should complete a task in progress",
+		status: model.StatusDoing,
+		method: http.MethodPost,
+		url:    "/tasks/1/complete",
+		code:   http.StatusOK,
+		expect: model.StatusDone,
+	},
+	{
+		name:   "should reopen a completed task",
+		status: model.StatusDone,
+		method: http.MethodPost,
+		url:    "/tasks/1/reopen",
+		code:   http.StatusOK,
+		expect: model.StatusPending,
+	},
+	{
+		name:   "should response with a status 409 Conflict when completing a pending task",
+		status: model.StatusPending,
+		method: http.MethodPost,
+		url:    "/tasks/1/complete",
+		code:   http.StatusConflict,
+		expect: model.StatusPending,
+	},
+	{
+		name:   "should response with a status 409 Conflict when starting a task in progress",
+		status: model.StatusDoing,
+		method: http.MethodPost,
+		url:    "/tasks/1/start",
+		code:   http.StatusConflict,
+		expect: model.StatusDoing,
+	},
+	{
+		name:   "should response with a status 404 Not Found for an unknown action",
+		status: model.StatusPending,
+		method: http.MethodPost,
+		url:    "/tasks/1/hoge",
+		code:   http.StatusNotFound,
+		expect: model.StatusPending,
+	},
+	{
+		name:   "should response with a status 404 Not Found for an unknown task",
+		status: model.StatusPending,
+		method: http.MethodPost,
+		url:    "/tasks/2/start",
+		code:   http.StatusNotFound,
+		expect: model.StatusPending,
+	},
+	{
+		name:   "should response with a status 409 Conflict when a completed task is moved back by an update",
+		status: model.StatusDone,
+		method: http.MethodPut,
+		url:    "/tasks/1",
+		body:   `{"title":"go to school","status":"DOING","priority":1}`,
+		code:   http.StatusConflict,
+		expect: model.StatusDone,
+	},
+	{
+		name:   "should response with a status 409 Conflict when a pending task is completed by a patch",
+		status: model.StatusPending,
+		method: http.MethodPatch,
+		url:    "/tasks/1",
+		body:   `{"status":"DONE"}`,
+		code:   http.StatusConflict,
+		expect: model.StatusPending,
+	},
+}
+
+func TestApplyAction(t *testing.T) {
+	t.Log("moving tasks through the workflow...")
+
+	for _, testcase := range actionTests {
+		t.Log(testcase.name)
+
+		ds := &store.Datastore{}
+		ds.SaveTask(model.Task{Title: "go to school", Status: testcase.status, Priority: 1})
+
+		rec := httptest.NewRecorder()
+		req, _ := http.NewRequest(testcase.method, testcase.url, bytes.NewBufferString(testcase.body))
+		req.Header.Set("Content-Type", mergePatchType)
+
+		New(ds).ServeHTTP(rec, req)
+
+		if rec.Code != testcase.code {
+			t.Errorf("KO => Got %d expected %d", rec.Code, testcase.code)
+		}
+		if task, _ := ds.GetTask(1); task.Status != testcase.expect {
+			t.Errorf("KO => Got %s expected %s", task.Status, testcase.expect)
+		}
+	}
+}
+
+func TestCustomWorkflow(t *testing.T) {
+	t.Log("loading a custom workflow...")
+
+	path := filepath.Join(t.TempDir(), "workflow.json")
+	os.WriteFile(path, []byte(`{
+		"statuses": ["PENDING", "DOING", "BLOCKED", "REVIEW", "DONE"],
+		"transitions": [
+			{"action": "start", "from": ["PENDING", "BLOCKED"], "to": "DOING"},
+			{"action": "block", "from": ["DOING"], "to": "BLOCKED"},
+			{"action": "review", "from": ["DOING"], "to": "REVIEW"},
+			{"action": "approve", "from": ["REVIEW"], "to": "DONE"}
+		]
+	}`), 0644)
+
+	workflow, err := model.LoadWorkflow(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ds := &store.Datastore{}
+	ds.SaveTask(model.Task{Title: "go to school", Status: model.StatusPending, Priority: 1})
+	s := New(ds, WithWorkflow(workflow))
+
+	for _, testcase := range []struct {
+		action string
+		code   int
+		expect model.Status
+	}{
+		{action: "start", code: http.StatusOK, expect: "DOING"},
+		{action: "block", code: http.StatusOK, expect: "BLOCKED"},
+		{action: "review", code: http.StatusConflict, expect: "BLOCKED"},
+		{action: "start", code: http.StatusOK, expect: "DOING"},
+		{action: "review", code: http.StatusOK, expect: "REVIEW"},
+		{action: "complete", code: http.StatusNotFound, expect: "REVIEW"},
+		{action: "approve", code: http.StatusOK, expect: "DONE"},
+	} {
+		rec := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodPost, "/tasks/1/"+testcase.action, nil)
+
+		s.ServeHTTP(rec, req)
+
+		if rec.Code != testcase.code {
+			t.Errorf("KO => %s: Got %d expected %d", testcase.action, rec.Code, testcase.code)
+		}
+		if task, _ := ds.GetTask(1); task.Status != testcase.expect {
+			t.Errorf("KO => %s: Got %s expected %s", testcase.action, task.Status, testcase.expect)
+		}
+	}
+}
+
+func TestStrictParents(t *testing.T) {
+	t.Log("completing parents before their children...")
+
+	ds := &store.Datastore{}
+	ds.SaveTask(model.Task{Title: "release", Status: model.StatusDoing, Priority: 1})
+	ds.SaveTask(model.Task{Title: "write notes", Status: model.StatusDoing, Priority: 1, Parent: 1})
+
+	for _, testcase := range []struct {
+		server *Server
+		code   int
+	}{
+		{server: New(ds, WithStrictParents()), code: http.StatusConflict},
+		{server: New(ds), code: http.StatusOK},
+	} {
+		rec := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodPost, "/tasks/1/complete", nil)
+
+		testcase.server.ServeHTTP(rec, req)
+
+		if rec.Code != testcase.code {
+			t.Errorf("KO => Got %d expected %d", rec.Code, testcase.code)
+		}
+	}
+
+	ds.SaveTask(model.Task{ID: 1, Title: "release", Status: model.StatusDoing, Priority: 1})
+	ds.SaveTask(model.Task{ID: 2, Title: "write notes", Status: model.StatusDone, Priority: 1, Parent: 1})
+
+	rec := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodPost, "/tasks/1/complete", nil)
+
+	New(ds, WithStrictParents()).ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Errorf("KO => Got %d expected %d", rec.Code, http.StatusOK)
+	}
+}
+
+var invalidWorkflowTests = []struct {
+	name     string
+	workflow model.Workflow
+}{
+	{
+		name:     "should reject a workflow without status",
+		workflow: model.Workflow{},
+	},
+	{
+		name: "should reject a workflow without PENDING and DONE",
+		workflow: model.Workflow{
+			Statuses: []model.Status{"OPEN", "CLOSED"},
+		},
+	},
+	{
+		name: "should reject a status which is not upper case",
+		workflow: model.Workflow{
+			Statuses: []model.Status{"PENDING", "review", "DONE"},
+		},
+	},
+	{
+		name: "should reject a transition to an unknown status",
+		workflow: model.Workflow{
+			Statuses:    []model.Status{"PENDING", "DONE"},
+			Transitions: []model.Transition{{Action: "start", From: []model.Status{"PENDING"}, To: "DOING"}},
+		},
+	},
+	{
+		name: "should reject an action defined twice",
+		workflow: model.Workflow{
+			Statuses: []model.Status{"PENDING", "DOING", "DONE"},
+			Transitions: []model.Transition{
+				{Action: "start", From: []model.Status{"PENDING"}, To: "DOING"},
+				{Action: "start", From: []model.Status{"DOING"}, To: "PENDING"},
+			},
+		},
+	},
+}
+
+func TestInvalidWorkflow(t *testing.T) {
+	t.Log("validating workflows...")
+
+	for _, testcase := range invalidWorkflowTests {
+		t.Log(testcase.name)
+		if err := testcase.workflow.Validate(); err == nil {
+			t.Errorf("KO => Got no error expected one")
+		}
+	}
+}
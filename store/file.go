@@ -0,0 +1,305 @@
+package store
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/toversus/tbdist/model"
+)
+
+const (
+	snapshotFile = "snapshot.json"
+	logFile      = "tasks.log"
+)
+
+// FileStore is a Datastore persisted in a local data directory.
+// Every change is appended to a log and synced to disk before it is
+// applied, and the log is periodically compacted into a snapshot
+type FileStore struct {
+	*Datastore
+	dir  string
+	log  *os.File
+	err  error // err is set when a failed write could not be cut off the log
+	stop chan struct{}
+	done chan struct{}
+}
+
+// snapshot is the content of the snapshot file
+type snapshot struct {
+	LastID int         `json:"last_id"`
+	Tasks  model.Tasks `json:"tasks"`
+}
+
+// record is a line of the log file
+type record struct {
+	Op   string      `json:"op"` // put or delete
+	Task *model.Task `json:"task,omitempty"`
+	ID   int         `json:"id,omitempty"`
+}
+
+// OpenFileStore loads the tasks stored in dir, creating the directory when
+// it does not exist, and snapshots them every interval. A zero interval
+// disables periodic snapshots, one is still taken by Close
+func OpenFileStore(dir string, interval time.Duration) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	ds := &Datastore{}
+	if err := loadSnapshot(ds, filepath.Join(dir, snapshotFile)); err != nil {
+		return nil, err
+	}
+
+	log, err := os.OpenFile(filepath.Join(dir, logFile), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if err := replay(ds, log); err != nil {
+		log.Close()
+		return nil, err
+	}
+
+	fs := &FileStore{
+		Datastore: ds,
+		dir:       dir,
+		log:       log,
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+	ds.journal = fs
+
+	go fs.run(interval)
+	return fs, nil
+}
+
+// Snapshot writes every task to the snapshot file and empties the log
+func (fs *FileStore) Snapshot() error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	return fs.snapshot()
+}
+
+// Close takes a last snapshot and releases the log file
+func (fs *FileStore) Close() error {
+	close(fs.stop)
+	<-fs.done
+
+	err := fs.Snapshot()
+	if cerr := fs.log.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+func (fs *FileStore) run(interval time.Duration) {
+	defer close(fs.done)
+
+	if interval <= 0 {
+		<-fs.stop
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := fs.Snapshot(); err != nil {
+				log.Printf("store: snapshot of %s: %v", fs.dir, err)
+			}
+		case <-fs.stop:
+			return
+		}
+	}
+}
+
+// snapshot replaces the snapshot file atomically, fs.mu must be held
+func (fs *FileStore) snapshot() error {
+	j, err := json.Marshal(snapshot{LastID: fs.lastID, Tasks: fs.tasks})
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(fs.dir, snapshotFile)
+	if err := writeFile(path+".tmp", j); err != nil {
+		return err
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return err
+	}
+	if err := syncDir(fs.dir); err != nil {
+		return err
+	}
+
+	// The snapshot holds every change of the log from now on
+	if err := fs.log.Truncate(0); err != nil {
+		return err
+	}
+	if _, err := fs.log.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if err := fs.log.Sync(); err != nil {
+		return err
+	}
+	fs.err = nil
+	return nil
+}
+
+func (fs *FileStore) put(task model.Task) error {
+	return fs.append(record{Op: "put", Task: &task})
+}
+
+func (fs *FileStore) remove(id int) error {
+	return fs.append(record{Op: "delete", ID: id})
+}
+
+// append writes the record at the end of the log and syncs it to disk.
+// A record which could not be written entirely is cut off the log so that
+// the next ones are not appended to a torn line. When it can not be cut,
+// every write fails until a snapshot empties the log
+func (fs *FileStore) append(r record) error {
+	if fs.err != nil {
+		return fs.err
+	}
+
+	j, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	offset, err := fs.log.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	if _, err = fs.log.Write(append(j, '\n')); err == nil {
+		err = fs.log.Sync()
+	}
+	if err != nil {
+		if cerr := fs.cut(offset); cerr != nil {
+			fs.err = fmt.Errorf("store: log %s is torn: %v", fs.log.Name(), cerr)
+		}
+		return err
+	}
+	return nil
+}
+
+// cut truncates the log back to the offset and syncs it to disk
+func (fs *FileStore) cut(offset int64) error {
+	if err := fs.log.Truncate(offset); err != nil {
+		return err
+	}
+	if _, err := fs.log.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+	return fs.log.Sync()
+}
+
+func loadSnapshot(ds *Datastore, path string) error {
+	j, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var snap snapshot
+	if err := json.Unmarshal(j, &snap); err != nil {
+		return fmt.Errorf("store: corrupted snapshot %s: %v", path, err)
+	}
+	ds.tasks, ds.lastID = snap.Tasks, snap.LastID
+	for _, task := range ds.tasks {
+		ds.indexTags(task, 1)
+	}
+	return nil
+}
+
+// replay applies the records of the log to the datastore. A record torn
+// by a crash can only be the last one, it is cut off the log
+func replay(ds *Datastore, log *os.File) error {
+	var offset int64
+	rd := bufio.NewReader(log)
+	for {
+		line, err := rd.ReadBytes('\n')
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		var r record
+		if err := json.Unmarshal(bytes.TrimSpace(line), &r); err != nil || !r.valid() {
+			break
+		}
+		ds.apply(r)
+		offset += int64(len(line))
+	}
+
+	if err := log.Truncate(offset); err != nil {
+		return err
+	}
+	_, err := log.Seek(offset, io.SeekStart)
+	return err
+}
+
+func (r record) valid() bool {
+	return r.Op == "put" && r.Task != nil || r.Op == "delete"
+}
+
+// apply replays a record, records already held by the snapshot are
+// applied again without harm
+func (ds *Datastore) apply(r record) {
+	switch r.Op {
+	case "put":
+		for i, t := range ds.tasks {
+			if t.ID == r.Task.ID {
+				ds.replace(i, *r.Task)
+				return
+			}
+		}
+		ds.insert(*r.Task)
+	case "delete":
+		for i, t := range ds.tasks {
+			if t.ID == r.ID {
+				ds.remove(i)
+				return
+			}
+		}
+	}
+}
+
+// writeFile writes the file and syncs it to disk before closing it
+func writeFile(path string, data []byte) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// syncDir makes a rename within the directory durable
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
@@ -0,0 +1,195 @@
+package store
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/toversus/tbdist/model"
+)
+
+// crash releases the log without taking a snapshot as a killed process would
+func crash(fs *FileStore) {
+	close(fs.stop)
+	<-fs.done
+	fs.log.Close()
+}
+
+var fileStoreTests = []struct {
+	name   string
+	after  func(t *testing.T, fs *FileStore, dir string)
+	expect model.Tasks
+	lastID int
+}{
+	{
+		name: "should recover tasks from the log after a crash",
+		after: func(t *testing.T, fs *FileStore, dir string) {
+			crash(fs)
+		},
+		expect: model.Tasks{
+			{ID: 1, Title: "go to school", Status: "DONE", Priority: 1, Version: 2},
+			{ID: 3, Title: "play piano", Status: "DOING", Priority: 5, Version: 1},
+		},
+		lastID: 3,
+	},
+	{
+		name: "should recover tasks from the snapshot and the log",
+		after: func(t *testing.T, fs *FileStore, dir string) {
+			if err := fs.Snapshot(); err != nil {
+				t.Fatal(err)
+			}
+			fs.SaveTask(model.Task{Title: "go shopping", Status: "PENDING", Priority: 2})
+			crash(fs)
+		},
+		expect: model.Tasks{
+			{ID: 1, Title: "go to school", Status: "DONE", Priority: 1, Version: 2},
+			{ID: 3, Title: "play piano", Status: "DOING", Priority: 5, Version: 1},
+			{ID: 4, Title: "go shopping", Status: "PENDING", Priority: 2, Version: 1},
+		},
+		lastID: 4,
+	},
+	{
+		name: "should recover tasks from the snapshot taken on close",
+		after: func(t *testing.T, fs *FileStore, dir string) {
+			if err := fs.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if info, _ := os.Stat(filepath.Join(dir, logFile)); info.Size() != 0 {
+				t.Errorf("=> Got a log of %d bytes expected an empty log", info.Size())
+			}
+		},
+		expect: model.Tasks{
+			{ID: 1, Title: "go to school", Status: "DONE", Priority: 1, Version: 2},
+			{ID: 3, Title: "play piano", Status: "DOING", Priority: 5, Version: 1},
+		},
+		lastID: 3,
+	},
+	{
+		name: "should drop a record torn by a crash",
+		after: func(t *testing.T, fs *FileStore, dir string) {
+			crash(fs)
+			f, _ := os.OpenFile(filepath.Join(dir, logFile), os.O_WRONLY|os.O_APPEND, 0644)
+			f.WriteString(`{"op":"put","task":{"id":4,"tit`)
+			f.Close()
+		},
+		expect: model.Tasks{
+			{ID: 1, Title: "go to school", Status: "DONE", Priority: 1, Version: 2},
+			{ID: 3, Title: "play piano", Status: "DOING", Priority: 5, Version: 1},
+		},
+		lastID: 3,
+	},
+	{
+		name: "should index the tags of the recovered tasks",
+		after: func(t *testing.T, fs *FileStore, dir string) {
+			fs.SaveTask(model.Task{ID: 3, Title: "play piano", Status: "DOING", Priority: 5, Tags: []string{"music"}})
+			fs.Snapshot()
+			fs.SaveTask(model.Task{Title: "go shopping", Status: "PENDING", Priority: 2, Tags: []string{"home"}})
+			crash(fs)
+		},
+		expect: model.Tasks{
+			{ID: 1, Title: "go to school", Status: "DONE", Priority: 1, Version: 2},
+			{ID: 3, Title: "play piano", Status: "DOING", Priority: 5, Tags: []string{"music"}, Version: 2},
+			{ID: 4, Title: "go shopping", Status: "PENDING", Priority: 2, Tags: []string{"home"}, Version: 1},
+		},
+		lastID: 4,
+	},
+}
+
+func TestFileStore(t *testing.T) {
+	t.Log("persisting tasks...")
+
+	for _, testcase := range fileStoreTests {
+		t.Log(testcase.name)
+
+		dir := t.TempDir()
+		fs, err := OpenFileStore(dir, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		fs.SaveTask(model.Task{Title: "go to school", Status: "PENDING", Priority: 1})
+		fs.SaveTask(model.Task{Title: "withdraw my money", Status: "PENDING", Priority: 3})
+		fs.SaveTask(model.Task{Title: "play piano", Status: "DOING", Priority: 5})
+		fs.SaveTask(model.Task{ID: 1, Title: "go to school", Status: "DONE", Priority: 1})
+		fs.DeleteTask(2, 0)
+
+		testcase.after(t, fs, dir)
+
+		fs, err = OpenFileStore(dir, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(fs.tasks, testcase.expect) {
+			t.Errorf("=> Got %#v expected %#v", fs.tasks, testcase.expect)
+		}
+		if fs.lastID != testcase.lastID {
+			t.Errorf("=> Got last ID %d expected %d", fs.lastID, testcase.lastID)
+		}
+		tags := make(map[string]int)
+		for _, task := range testcase.expect {
+			for _, tag := range task.Tags {
+				tags[tag]++
+			}
+		}
+		if !reflect.DeepEqual(fs.GetTags(), tags) {
+			t.Errorf("=> Got tags %v expected %v", fs.GetTags(), tags)
+		}
+
+		// The next task keeps on numbering from the recovered last ID
+		fs.SaveTask(model.Task{Title: "pay the rent", Status: "PENDING", Priority: 9})
+		if task, err := fs.GetTask(testcase.lastID + 1); err != nil || task.Title != "pay the rent" {
+			t.Errorf("=> Got %#v, %v expected the new task", task, err)
+		}
+		fs.Close()
+	}
+}
+
+func TestFailedWrite(t *testing.T) {
+	t.Log("failing to write the log...")
+
+	dir := t.TempDir()
+	fs, err := OpenFileStore(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fs.SaveTask(model.Task{Title: "go to school", Status: "PENDING", Priority: 1})
+
+	// A read-only log fails the write and can not be cut either
+	rw := fs.log
+	ro, err := os.Open(rw.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	fs.log = ro
+	if _, err := fs.SaveTask(model.Task{Title: "withdraw my money", Status: "PENDING", Priority: 3}); err == nil {
+		t.Errorf("=> Got no error for a failed write")
+	}
+
+	// Every write is refused until a snapshot empties the log
+	fs.log = rw
+	if _, err := fs.SaveTask(model.Task{Title: "play piano", Status: "DOING", Priority: 5}); err == nil {
+		t.Errorf("=> Got no error for a write after a torn one")
+	}
+	if err := fs.Snapshot(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fs.SaveTask(model.Task{Title: "pay the rent", Status: "PENDING", Priority: 9}); err != nil {
+		t.Errorf("=> Got %v expected the write to succeed after a snapshot", err)
+	}
+	ro.Close()
+	crash(fs)
+
+	fs, err = OpenFileStore(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fs.Close()
+	expect := model.Tasks{
+		{ID: 1, Title: "go to school", Status: "PENDING", Priority: 1, Version: 1},
+		{ID: 2, Title: "pay the rent", Status: "PENDING", Priority: 9, Version: 1},
+	}
+	if !reflect.DeepEqual(fs.tasks, expect) {
+		t.Errorf("=> Got %#v expected %#v", fs.tasks, expect)
+	}
+}
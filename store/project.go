@@ -0,0 +1,311 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/toversus/tbdist/model"
+)
+
+// ErrProjectNotFound is returned when a project ID is not found
+var ErrProjectNotFound = errors.New("Project was not found")
+
+// ErrInvalidProject is returned when a project ID can not be used as a
+// directory name
+var ErrInvalidProject = errors.New("Project ID is invalid")
+
+const projectsFile = "projects.json"
+
+// Projects manages named projects, each holding its own tasks.
+// It is safe for concurrent use
+type Projects struct {
+	mu       sync.RWMutex // mu guards projects
+	projects map[string]*project
+	dir      string        // dir persists the projects, empty to keep them in memory
+	interval time.Duration // interval between two snapshots of a project
+}
+
+type project struct {
+	model.Project
+	tasks *Datastore
+	file  *FileStore // file persists the tasks, nil when they are kept in memory
+}
+
+// NewProjects returns an empty registry of projects kept in memory
+func NewProjects() *Projects {
+	return &Projects{projects: make(map[string]*project)}
+}
+
+// OpenFileProjects loads the projects stored in dir, the tasks of each
+// project are kept in a FileStore in a subdirectory named after its ID
+func OpenFileProjects(dir string, interval time.Duration) (*Projects, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	ps := &Projects{projects: make(map[string]*project), dir: dir, interval: interval}
+
+	j, err := os.ReadFile(filepath.Join(dir, projectsFile))
+	if os.IsNotExist(err) {
+		return ps, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var list []model.Project
+	if err := json.Unmarshal(j, &list); err != nil {
+		return nil, fmt.Errorf("store: corrupted projects %s: %v", dir, err)
+	}
+	for _, p := range list {
+		fs, err := OpenFileStore(filepath.Join(dir, p.ID), interval)
+		if err != nil {
+			ps.Close()
+			return nil, err
+		}
+		ps.projects[p.ID] = &project{Project: p, tasks: fs.Datastore, file: fs}
+	}
+	return ps, nil
+}
+
+// Close releases the files of the projects
+func (ps *Projects) Close() error {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	var err error
+	for _, p := range ps.projects {
+		if p.file == nil {
+			continue
+		}
+		if cerr := p.file.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// GetProjects returns every project sorted by ID
+func (ps *Projects) GetProjects() []model.Project {
+	ps.mu.RLock()
+	defer ps.mu.RUnlock()
+
+	list := make([]model.Project, 0, len(ps.projects))
+	for _, p := range ps.projects {
+		list = append(list, p.Project)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list
+}
+
+// GetProject returns the project with the given ID. A Project Not Found
+// error is returned when the project ID does not exist
+func (ps *Projects) GetProject(id string) (model.Project, error) {
+	ps.mu.RLock()
+	defer ps.mu.RUnlock()
+
+	p, ok := ps.projects[id]
+	if !ok {
+		return model.Project{}, ErrProjectNotFound
+	}
+	return p.Project, nil
+}
+
+// Tasks returns the datastore of the project with the given ID. A Project
+// Not Found error is returned when the project ID does not exist
+func (ps *Projects) Tasks(id string) (*Datastore, error) {
+	ps.mu.RLock()
+	defer ps.mu.RUnlock()
+
+	p, ok := ps.projects[id]
+	if !ok {
+		return nil, ErrProjectNotFound
+	}
+	return p.tasks, nil
+}
+
+// SaveProject creates the project if it does not exist else updates its
+// name and settings, the project is returned as stored
+func (ps *Projects) SaveProject(p model.Project) (model.Project, error) {
+	if !model.ValidProjectID(p.ID) {
+		return model.Project{}, ErrInvalidProject
+	}
+
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	if _, ok := ps.projects[p.ID]; ok {
+		return ps.update(p)
+	}
+	return ps.create(p)
+}
+
+// AddProject creates the project. A Conflict error is returned when a
+// project with the same ID already exists
+func (ps *Projects) AddProject(p model.Project) (model.Project, error) {
+	if !model.ValidProjectID(p.ID) {
+		return model.Project{}, ErrInvalidProject
+	}
+
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	if _, ok := ps.projects[p.ID]; ok {
+		return model.Project{}, fmt.Errorf("%w: project %s already exists", ErrConflict, p.ID)
+	}
+	return ps.create(p)
+}
+
+// UpdateProject updates the name and settings of the project. A Project
+// Not Found error is returned when the project ID does not exist
+func (ps *Projects) UpdateProject(p model.Project) (model.Project, error) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	if _, ok := ps.projects[p.ID]; !ok {
+		return model.Project{}, ErrProjectNotFound
+	}
+	return ps.update(p)
+}
+
+// create stores a new project and opens its datastore, ps.mu must be held
+func (ps *Projects) create(p model.Project) (model.Project, error) {
+	created := &project{Project: p, tasks: &Datastore{}}
+	if ps.dir != "" {
+		fs, err := OpenFileStore(filepath.Join(ps.dir, p.ID), ps.interval)
+		if err != nil {
+			return model.Project{}, err
+		}
+		created.tasks, created.file = fs.Datastore, fs
+	}
+
+	ps.projects[p.ID] = created
+	if err := ps.save(); err != nil {
+		delete(ps.projects, p.ID)
+		if created.file != nil {
+			created.file.Close()
+		}
+		return model.Project{}, err
+	}
+	return p, nil
+}
+
+// update replaces the name and settings of a stored project, ps.mu must be held
+func (ps *Projects) update(p model.Project) (model.Project, error) {
+	stored := ps.projects[p.ID]
+	previous := stored.Project
+	stored.Project = p
+	if err := ps.save(); err != nil {
+		stored.Project = previous
+		return model.Project{}, err
+	}
+	return p, nil
+}
+
+// DeleteProject removes the project. A Project Not Found error is returned
+// when the project ID does not exist and a Conflict error when the project
+// still has tasks. The tasks of a removed project can not be written anymore,
+// such writes fail with a Project Not Found error
+func (ps *Projects) DeleteProject(id string) error {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	p, ok := ps.projects[id]
+	if !ok {
+		return ErrProjectNotFound
+	}
+	// The datastore may have been handed out before, retiring it keeps
+	// tasks from being saved in the project once it is found empty
+	if !p.tasks.retire(ErrProjectNotFound) {
+		return fmt.Errorf("%w: project %s still has tasks", ErrConflict, id)
+	}
+
+	delete(ps.projects, id)
+	if err := ps.save(); err != nil {
+		ps.projects[id] = p
+		p.tasks.retire(nil)
+		return err
+	}
+	if p.file != nil {
+		p.file.Close()
+		return os.RemoveAll(filepath.Join(ps.dir, id))
+	}
+	return nil
+}
+
+// MoveTask moves a task to another project where it gets a new ID.
+// The task leaves its parent and its blockers behind. It is saved in the
+// destination before it is deleted from the source, and removed from the
+// destination again when the deletion fails. Errors are those of
+// DeleteTask on the source project and a Project Not Found error when one
+// of the projects does not exist
+func (ps *Projects) MoveTask(from, to string, id, version int) (model.Task, error) {
+	// Holding ps.mu for writing keeps the projects from being deleted
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	src, ok := ps.projects[from]
+	if !ok {
+		return model.Task{}, ErrProjectNotFound
+	}
+	dst, ok := ps.projects[to]
+	if !ok {
+		return model.Task{}, ErrProjectNotFound
+	}
+
+	task, err := src.tasks.GetTask(id)
+	if err != nil {
+		return model.Task{}, err
+	}
+	if version != 0 && version != task.Version {
+		return model.Task{}, ErrVersionMismatch
+	}
+
+	moved := task
+	moved.ID, moved.Version, moved.Parent, moved.BlockedBy = 0, 0, 0, nil
+	moved, err = dst.tasks.SaveTask(moved)
+	if err != nil {
+		return model.Task{}, err
+	}
+
+	// The version read above makes sure the task deleted is the one copied
+	if err := src.tasks.DeleteTask(id, task.Version); err != nil {
+		if rerr := dst.tasks.DeleteTask(moved.ID, moved.Version); rerr != nil {
+			return model.Task{}, fmt.Errorf("%w, task %d of %s left behind: %v", err, moved.ID, to, rerr)
+		}
+		return model.Task{}, err
+	}
+	return moved, nil
+}
+
+// save writes the list of the projects atomically, ps.mu must be held
+func (ps *Projects) save() error {
+	if ps.dir == "" {
+		return nil
+	}
+
+	list := make([]model.Project, 0, len(ps.projects))
+	for _, p := range ps.projects {
+		list = append(list, p.Project)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+
+	j, err := json.Marshal(list)
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(ps.dir, projectsFile)
+	if err := writeFile(path+".tmp", j); err != nil {
+		return err
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return err
+	}
+	return syncDir(ps.dir)
+}
@@ -0,0 +1,233 @@
+package store
+
+import (
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/toversus/tbdist/model"
+)
+
+var projectTests = []struct {
+	name   string
+	run    func(ps *Projects) error
+	expect []model.Project
+	err    error
+}{
+	{
+		name: "should save new projects sorted by ID",
+		run: func(ps *Projects) error {
+			ps.SaveProject(model.Project{ID: "web", Name: "Web", Settings: model.DefaultSettings})
+			_, err := ps.SaveProject(model.Project{ID: "api", Name: "API", Settings: model.DefaultSettings})
+			return err
+		},
+		expect: []model.Project{
+			{ID: "api", Name: "API", Settings: model.DefaultSettings},
+			{ID: "web", Name: "Web", Settings: model.DefaultSettings},
+		},
+	},
+	{
+		name: "should update the settings of a project",
+		run: func(ps *Projects) error {
+			ps.SaveProject(model.Project{ID: "api", Name: "API", Settings: model.DefaultSettings})
+			_, err := ps.SaveProject(model.Project{ID: "api", Name: "API", Settings: model.Settings{MinPriority: 1, MaxPriority: 3}})
+			return err
+		},
+		expect: []model.Project{
+			{ID: "api", Name: "API", Settings: model.Settings{MinPriority: 1, MaxPriority: 3}},
+		},
+	},
+	{
+		name: "should return an error when the project ID is invalid",
+		run: func(ps *Projects) error {
+			_, err := ps.SaveProject(model.Project{ID: "../api", Name: "API"})
+			return err
+		},
+		expect: []model.Project{},
+		err:    ErrInvalidProject,
+	},
+	{
+		name: "should delete an empty project",
+		run: func(ps *Projects) error {
+			ps.SaveProject(model.Project{ID: "api", Name: "API"})
+			return ps.DeleteProject("api")
+		},
+		expect: []model.Project{},
+	},
+	{
+		name: "should return an error when the deleted project still has tasks",
+		run: func(ps *Projects) error {
+			ps.SaveProject(model.Project{ID: "api", Name: "API"})
+			tasks, _ := ps.Tasks("api")
+			tasks.SaveTask(model.Task{Title: "fix login", Status: "PENDING", Priority: 1})
+			return ps.DeleteProject("api")
+		},
+		expect: []model.Project{{ID: "api", Name: "API"}},
+		err:    ErrConflict,
+	},
+	{
+		name: "should not overwrite an existing project when adding one",
+		run: func(ps *Projects) error {
+			ps.AddProject(model.Project{ID: "api", Name: "API"})
+			_, err := ps.AddProject(model.Project{ID: "api", Name: "Other"})
+			return err
+		},
+		expect: []model.Project{{ID: "api", Name: "API"}},
+		err:    ErrConflict,
+	},
+	{
+		name: "should update an existing project",
+		run: func(ps *Projects) error {
+			ps.AddProject(model.Project{ID: "api", Name: "API"})
+			_, err := ps.UpdateProject(model.Project{ID: "api", Name: "Public API"})
+			return err
+		},
+		expect: []model.Project{{ID: "api", Name: "Public API"}},
+	},
+	{
+		name: "should not create a project when updating one",
+		run: func(ps *Projects) error {
+			_, err := ps.UpdateProject(model.Project{ID: "api", Name: "API"})
+			return err
+		},
+		expect: []model.Project{},
+		err:    ErrProjectNotFound,
+	},
+	{
+		name: "should return an error when the project does not exist",
+		run: func(ps *Projects) error {
+			_, err := ps.Tasks("api")
+			return err
+		},
+		expect: []model.Project{},
+		err:    ErrProjectNotFound,
+	},
+}
+
+func TestProjects(t *testing.T) {
+	t.Log("managing projects...")
+
+	for _, testcase := range projectTests {
+		t.Log(testcase.name)
+
+		for _, ps := range []*Projects{NewProjects(), openProjects(t, t.TempDir())} {
+			err := testcase.run(ps)
+			if !errors.Is(err, testcase.err) {
+				t.Errorf("=> Got %v expected %v", err, testcase.err)
+			}
+			if projects := ps.GetProjects(); !reflect.DeepEqual(projects, testcase.expect) {
+				t.Errorf("=> Got %#v expected %#v", projects, testcase.expect)
+			}
+			ps.Close()
+		}
+	}
+}
+
+func TestMoveTask(t *testing.T) {
+	t.Log("moving tasks between projects...")
+
+	dir := t.TempDir()
+	ps := openProjects(t, dir)
+	ps.SaveProject(model.Project{ID: "api", Name: "API"})
+	ps.SaveProject(model.Project{ID: "web", Name: "Web"})
+
+	api, _ := ps.Tasks("api")
+	web, _ := ps.Tasks("web")
+	api.SaveTask(model.Task{Title: "design", Status: "DONE", Priority: 1})
+	api.SaveTask(model.Task{Title: "fix login", Status: "PENDING", Priority: 2, BlockedBy: []int{1}})
+	web.SaveTask(model.Task{Title: "fix button", Status: "PENDING", Priority: 3})
+
+	if _, err := ps.MoveTask("api", "web", 2, 2); err != ErrVersionMismatch {
+		t.Errorf("=> Got %v expected %v", err, ErrVersionMismatch)
+	}
+	if _, err := ps.MoveTask("api", "web", 1, 0); !errors.Is(err, ErrConflict) {
+		t.Errorf("=> Got %v expected %v", err, ErrConflict)
+	}
+	if _, err := ps.MoveTask("api", "app", 2, 0); err != ErrProjectNotFound {
+		t.Errorf("=> Got %v expected %v", err, ErrProjectNotFound)
+	}
+	// A failed move leaves the task in the source only
+	if tasks := api.FindTasks(model.Query{}); len(tasks) != 2 {
+		t.Errorf("=> Got %#v expected both tasks left in api", tasks)
+	}
+	if tasks := web.FindTasks(model.Query{}); len(tasks) != 1 || tasks[0].Title != "fix button" {
+		t.Errorf("=> Got %#v expected the fix button task only", tasks)
+	}
+
+	moved, err := ps.MoveTask("api", "web", 2, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The ID taken by the move rolled back is not reused
+	expect := model.Task{ID: 3, Title: "fix login", Status: "PENDING", Priority: 2, Version: 1}
+	if !reflect.DeepEqual(moved, expect) {
+		t.Errorf("=> Got %#v expected %#v", moved, expect)
+	}
+	ps.Close()
+
+	// The tasks of every project are recovered from the data directory
+	ps = openProjects(t, dir)
+	defer ps.Close()
+	api, _ = ps.Tasks("api")
+	web, _ = ps.Tasks("web")
+	if tasks := api.FindTasks(model.Query{}); len(tasks) != 1 || tasks[0].Title != "design" {
+		t.Errorf("=> Got %#v expected the design task only", tasks)
+	}
+	if tasks := web.FindTasks(model.Query{}); !reflect.DeepEqual(tasks[1], expect) {
+		t.Errorf("=> Got %#v expected %#v", tasks, expect)
+	}
+}
+
+func TestDeletedProjectTasks(t *testing.T) {
+	t.Log("writing the tasks of a deleted project...")
+
+	for _, ps := range []*Projects{NewProjects(), openProjects(t, t.TempDir())} {
+		ps.AddProject(model.Project{ID: "api", Name: "API"})
+		tasks, _ := ps.Tasks("api")
+
+		if err := ps.DeleteProject("api"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tasks.SaveTask(model.Task{Title: "fix login", Status: "PENDING", Priority: 1}); err != ErrProjectNotFound {
+			t.Errorf("=> Got %v expected %v", err, ErrProjectNotFound)
+		}
+		if err := tasks.DeleteTask(1, 0); err != ErrProjectNotFound {
+			t.Errorf("=> Got %v expected %v", err, ErrProjectNotFound)
+		}
+		ps.Close()
+	}
+}
+
+func TestConcurrentAddProject(t *testing.T) {
+	t.Log("adding the same project concurrently...")
+
+	ps := NewProjects()
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	created := 0
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := ps.AddProject(model.Project{ID: "api", Name: "API"}); err == nil {
+				mu.Lock()
+				created++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if created != 1 {
+		t.Errorf("=> Got %d projects created expected 1", created)
+	}
+}
+
+func openProjects(t *testing.T, dir string) *Projects {
+	ps, err := OpenFileProjects(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ps
+}
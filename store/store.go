@@ -2,7 +2,10 @@ package store
 
 import (
 	"errors"
+	"fmt"
 	"sort"
+	"sync"
+	"time"
 
 	"github.com/toversus/tbdist/model"
 )
@@ -10,13 +13,36 @@ import (
 // ErrTaskNotFound is returned when a Task ID is not found
 var ErrTaskNotFound = errors.New("Task was not found")
 
-// Datastore manages a list of tasks stored in memory
+// ErrVersionMismatch is returned when a task was changed since the version
+// a modification was based on
+var ErrVersionMismatch = errors.New("Task version does not match")
+
+// ErrConflict is returned when a change clashes with the stored tasks
+var ErrConflict = errors.New("Task conflicts with the stored tasks")
+
+// Datastore manages a list of tasks stored in memory.
+// It is safe for concurrent use, readers do not block one another
 type Datastore struct {
-	tasks  model.Tasks
-	lastID int // lastID is incremented for each new stored task
+	mu      sync.RWMutex // mu guards tasks, lastID and tags
+	tasks   model.Tasks
+	lastID  int            // lastID is incremented for each new stored task
+	tags    map[string]int // tags counts the tasks labelled with each tag
+	journal journal        // journal records the changes when the tasks are persisted
+	retired error          // retired fails every write once the tasks are gone
+}
+
+// journal records the changes of a datastore before they are applied.
+// A change is not applied when it could not be recorded
+type journal interface {
+	put(task model.Task) error
+	remove(id int) error
 }
 
-func (ds *Datastore) getTasks(status string) model.Tasks {
+// GetTasksByStatus returns all the tasks in the given status
+func (ds *Datastore) GetTasksByStatus(status model.Status) model.Tasks {
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+
 	var tasks model.Tasks
 	for _, task := range ds.tasks {
 		if task.Status == status {
@@ -26,54 +52,417 @@ func (ds *Datastore) getTasks(status string) model.Tasks {
 	return tasks
 }
 
-func (ds *Datastore) getTasksSortedByPriority(status string) model.Tasks {
+// FindTasks returns the tasks matching the query in the requested order
+func (ds *Datastore) FindTasks(q model.Query) model.Tasks {
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+
 	var tasks model.Tasks
 	for _, task := range ds.tasks {
-		if task.Status == status {
+		if q.Match(task) && (!q.Ready || ds.unblocked(task)) {
 			tasks = append(tasks, task)
 		}
 	}
-	sort.Sort(model.ByPriority{Tasks: tasks})
+	sort.Stable(model.ByKeys{Tasks: tasks, Keys: q.Sort})
 	return tasks
 }
 
-// GetPendingTasks returns all the tasks putting on hold for now
-func (ds *Datastore) GetPendingTasks() model.Tasks {
-	return ds.getTasks("PENDING")
+// GetBlockers returns the tasks blocking the task with the given ID.
+// A Task Not Found error is returned when the task ID does not exist
+func (ds *Datastore) GetBlockers(id int) (model.Tasks, error) {
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+
+	i := ds.find(id)
+	if i < 0 {
+		return nil, ErrTaskNotFound
+	}
+
+	var tasks model.Tasks
+	for _, b := range ds.tasks[i].BlockedBy {
+		if j := ds.find(b); j >= 0 {
+			tasks = append(tasks, ds.tasks[j])
+		}
+	}
+	return tasks, nil
+}
+
+// GetTags returns the number of tasks labelled with each tag
+func (ds *Datastore) GetTags() map[string]int {
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+
+	tags := make(map[string]int, len(ds.tags))
+	for tag, n := range ds.tags {
+		tags[tag] = n
+	}
+	return tags
 }
 
-// GetDoingTasks returns all the tasks in progress
-func (ds *Datastore) GetDoingTasks() model.Tasks {
-	return ds.getTasks("DOING")
+// GetOverdueTasks returns the tasks not done yet whose deadline
+// has passed, the most overdue first
+func (ds *Datastore) GetOverdueTasks(now time.Time) model.Tasks {
+	return ds.FindTasks(model.Query{
+		DueBefore: now,
+		Open:      true,
+		Sort:      []model.SortKey{{Field: "due"}},
+	})
 }
 
-// GetDoneTasks returns all the completed tasks
-func (ds *Datastore) GetDoneTasks() model.Tasks {
-	return ds.getTasks("DONE")
+// GetTasksDueWithin returns the tasks not done yet whose deadline falls
+// within the window starting now, the earliest deadline first
+func (ds *Datastore) GetTasksDueWithin(now time.Time, window time.Duration) model.Tasks {
+	return ds.FindTasks(model.Query{
+		DueAfter:  now,
+		DueBefore: now.Add(window),
+		Open:      true,
+		Sort:      []model.SortKey{{Field: "due"}},
+	})
+}
+
+// GetTask returns the task with the given ID. A Task Not Found error
+// is returned when the task ID does not exist
+func (ds *Datastore) GetTask(id int) (model.Task, error) {
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+
+	for _, t := range ds.tasks {
+		if t.ID == id {
+			return t, nil
+		}
+	}
+
+	return model.Task{}, ErrTaskNotFound
 }
 
-// GetPendingTasksSortedByPriority returns all the completed tasks
-func (ds *Datastore) GetPendingTasksSortedByPriority() model.Tasks {
-	return ds.getTasksSortedByPriority("PENDING")
+// SaveTask should save the task in the datastore if the task does not
+// exist else update it and return the stored task, whose ID is assigned
+// for a new task. The version of the task is incremented on every save,
+// its tags are stored as a sorted set and the items of its checklist
+// without ID are numbered. Completing a recurring task stores its next
+// occurrence, both are linked to each other. Neither the links nor the
+// creator of a stored task can be changed by a save.
+// Return a Task Not Found error when the task ID does not exist
+// Return a Version Mismatch error when the version of the task is set
+// but differs from the stored one
+// Return a Conflict error when the parent of the task does not exist or
+// is one of its descendants, or when a blocker does not exist or is
+// blocked by the task
+func (ds *Datastore) SaveTask(task model.Task) (model.Task, error) {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	if ds.retired != nil {
+		return model.Task{}, ds.retired
+	}
+	return ds.save(task)
 }
 
-// SaveTask should save the task in the datastore if the task
-// does not exist else update it. A Task Not Found error is returned
-// when the task ID does not exist
-func (ds *Datastore) SaveTask(task model.Task) error {
+// SaveTasks saves the tasks as SaveTask does, either all of them or none.
+// Each task is checked against the ones saved before it. The stored tasks
+// are returned in the order of the list, else the error of the first
+// task which could not be saved once the tasks saved before it are
+// restored
+func (ds *Datastore) SaveTasks(tasks model.Tasks) (model.Tasks, error) {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	if ds.retired != nil {
+		return nil, ds.retired
+	}
+
+	saved := make(model.Tasks, 0, len(tasks))
+	previous := make(model.Tasks, 0, len(tasks)) // previous holds a zero task for a new one
+	for _, task := range tasks {
+		var stored model.Task
+		if i := ds.find(task.ID); task.ID != 0 && i >= 0 {
+			stored = ds.tasks[i]
+		}
+
+		t, err := ds.save(task)
+		if err != nil {
+			if rerr := ds.restore(saved, previous); rerr != nil {
+				return nil, fmt.Errorf("%w, tasks left partially saved: %v", err, rerr)
+			}
+			return nil, err
+		}
+		saved, previous = append(saved, t), append(previous, stored)
+	}
+	return saved, nil
+}
+
+// restore undoes the saves of the tasks in reverse order, removing the
+// occurrences they spawned. ds.mu must be held for writing
+func (ds *Datastore) restore(saved, previous model.Tasks) error {
+	for i := len(saved) - 1; i >= 0; i-- {
+		if saved[i].Next != previous[i].Next {
+			if err := ds.remove(ds.find(saved[i].Next)); err != nil {
+				return err
+			}
+		}
+		j := ds.find(saved[i].ID)
+		if previous[i].ID == 0 {
+			if err := ds.remove(j); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := ds.replace(j, previous[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// save is SaveTask, ds.mu must be held for writing
+func (ds *Datastore) save(task model.Task) (model.Task, error) {
+	task.Tags = model.NormalizeTags(task.Tags)
+	task.Checklist = task.Checklist.Number()
+	task.BlockedBy = model.NormalizeIDs(task.BlockedBy)
+
 	if task.ID == 0 {
-		ds.lastID++
-		task.ID = ds.lastID
-		ds.tasks = append(ds.tasks, task)
-		return nil
+		task.ID = ds.lastID + 1
+		task.Version = 1
+		task.Previous, task.Next = 0, 0
+		if err := ds.check(task); err != nil {
+			return model.Task{}, err
+		}
+		return task, ds.insert(task)
+	}
+
+	i := ds.find(task.ID)
+	if i < 0 {
+		return model.Task{}, ErrTaskNotFound
+	}
+	stored := ds.tasks[i]
+	if task.Version != 0 && task.Version != stored.Version {
+		return model.Task{}, ErrVersionMismatch
+	}
+	if err := ds.check(task); err != nil {
+		return model.Task{}, err
+	}
+	task.Version = stored.Version + 1
+	task.Previous, task.Next = stored.Previous, stored.Next
+	task.Creator = stored.Creator
+
+	if task.Status == model.StatusDone && stored.Status != model.StatusDone && task.Next == 0 {
+		if next, ok := ds.nextOccurrence(task); ok {
+			if err := ds.insert(next); err != nil {
+				return model.Task{}, err
+			}
+			task.Next = next.ID
+		}
+	}
+	if err := ds.replace(i, task); err != nil {
+		// The occurrence would be orphaned and spawned again by a retry
+		if task.Next != stored.Next {
+			ds.remove(ds.find(task.Next))
+		}
+		return model.Task{}, err
+	}
+	return task, nil
+}
+
+// retire makes every later write fail with err when the datastore is
+// empty, false is returned when it still holds tasks. A nil err makes
+// the datastore writable again
+func (ds *Datastore) retire(err error) bool {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	if len(ds.tasks) > 0 {
+		return false
 	}
+	ds.retired = err
+	return true
+}
+
+// nextOccurrence returns the task following a recurring task once it is
+// done, ok is false when the task does not recur anymore. ds.mu must be held
+func (ds *Datastore) nextOccurrence(task model.Task) (next model.Task, ok bool) {
+	if task.Recurrence == nil || task.Due == nil {
+		return next, false
+	}
+
+	due, rule, ok := task.Recurrence.Next(*task.Due)
+	if !ok {
+		return next, false
+	}
+
+	next = model.Task{
+		ID:          ds.lastID + 1,
+		Title:       task.Title,
+		Description: task.Description,
+		Status:      model.StatusPending,
+		Priority:    task.Priority,
+		Due:         &due,
+		Tags:        task.Tags,
+		Parent:      task.Parent,
+		Recurrence:  &rule,
+		Previous:    task.ID,
+		Creator:     task.Creator,
+		Assignee:    task.Assignee,
+		Version:     1,
+	}
+	for _, item := range task.Checklist {
+		item.Done = false
+		next.Checklist = append(next.Checklist, item)
+	}
+	return next, true
+}
+
+// DeleteTask removes the task from the datastore. A Task Not Found error
+// is returned when the task ID does not exist, a Version Mismatch error
+// when the version is not zero and differs from the stored one and
+// a Conflict error when the task still has children or blocks another task
+func (ds *Datastore) DeleteTask(id int, version int) error {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	if ds.retired != nil {
+		return ds.retired
+	}
+
+	i := ds.find(id)
+	if i < 0 {
+		return ErrTaskNotFound
+	}
+	if version != 0 && version != ds.tasks[i].Version {
+		return ErrVersionMismatch
+	}
+	for _, t := range ds.tasks {
+		if t.Parent == id {
+			return fmt.Errorf("%w: task %d has children", ErrConflict, id)
+		}
+		for _, b := range t.BlockedBy {
+			if b == id {
+				return fmt.Errorf("%w: task %d blocks task %d", ErrConflict, id, t.ID)
+			}
+		}
+	}
+	return ds.remove(i)
+}
+
+// check returns a Conflict error when the parent or the blockers of the
+// task do not exist or would create a cycle, ds.mu must be held
+func (ds *Datastore) check(task model.Task) error {
+	if err := ds.checkParent(task); err != nil {
+		return err
+	}
+	return ds.checkBlockers(task)
+}
 
+// checkParent returns a Conflict error when the parent of the task does
+// not exist or the task is one of its ancestors, ds.mu must be held
+func (ds *Datastore) checkParent(task model.Task) error {
+	for parent := task.Parent; parent != 0; {
+		if parent == task.ID {
+			return fmt.Errorf("%w: parent %d would create a cycle", ErrConflict, task.Parent)
+		}
+		i := ds.find(parent)
+		if i < 0 {
+			return fmt.Errorf("%w: parent %d does not exist", ErrConflict, parent)
+		}
+		parent = ds.tasks[i].Parent
+	}
+	return nil
+}
+
+// checkBlockers returns a Conflict error when a blocker of the task does
+// not exist or is blocked by the task, directly or not, ds.mu must be held
+func (ds *Datastore) checkBlockers(task model.Task) error {
+	visited := make(map[int]bool)
+	blockers := append([]int(nil), task.BlockedBy...)
+	for len(blockers) > 0 {
+		b := blockers[len(blockers)-1]
+		blockers = blockers[:len(blockers)-1]
+		if b == task.ID {
+			return fmt.Errorf("%w: blockers would create a cycle", ErrConflict)
+		}
+		if visited[b] {
+			continue
+		}
+		visited[b] = true
+
+		i := ds.find(b)
+		if i < 0 {
+			return fmt.Errorf("%w: blocker %d does not exist", ErrConflict, b)
+		}
+		blockers = append(blockers, ds.tasks[i].BlockedBy...)
+	}
+	return nil
+}
+
+// unblocked returns true if every blocker of the task is done,
+// ds.mu must be held
+func (ds *Datastore) unblocked(task model.Task) bool {
+	for _, b := range task.BlockedBy {
+		if i := ds.find(b); i >= 0 && ds.tasks[i].Status != model.StatusDone {
+			return false
+		}
+	}
+	return true
+}
+
+// find returns the index of the task with the given ID or -1, ds.mu must be held
+func (ds *Datastore) find(id int) int {
 	for i, t := range ds.tasks {
-		if t.ID == task.ID {
-			ds.tasks[i] = task
-			return nil
+		if t.ID == id {
+			return i
 		}
 	}
+	return -1
+}
 
-	return ErrTaskNotFound
+// insert appends a new task, ds.mu must be held for writing
+func (ds *Datastore) insert(task model.Task) error {
+	if ds.journal != nil {
+		if err := ds.journal.put(task); err != nil {
+			return err
+		}
+	}
+	ds.tasks = append(ds.tasks, task)
+	if task.ID > ds.lastID {
+		ds.lastID = task.ID
+	}
+	ds.indexTags(task, 1)
+	return nil
+}
+
+// replace overwrites the task of index i, ds.mu must be held for writing
+func (ds *Datastore) replace(i int, task model.Task) error {
+	if ds.journal != nil {
+		if err := ds.journal.put(task); err != nil {
+			return err
+		}
+	}
+	ds.indexTags(ds.tasks[i], -1)
+	ds.tasks[i] = task
+	ds.indexTags(task, 1)
+	return nil
+}
+
+// remove deletes the task of index i, ds.mu must be held for writing
+func (ds *Datastore) remove(i int) error {
+	if ds.journal != nil {
+		if err := ds.journal.remove(ds.tasks[i].ID); err != nil {
+			return err
+		}
+	}
+	ds.indexTags(ds.tasks[i], -1)
+	ds.tasks = append(ds.tasks[:i], ds.tasks[i+1:]...)
+	return nil
+}
+
+// indexTags adds delta to the count of every tag of the task,
+// ds.mu must be held for writing
+func (ds *Datastore) indexTags(task model.Task, delta int) {
+	if ds.tags == nil {
+		ds.tags = make(map[string]int)
+	}
+	for _, tag := range task.Tags {
+		if ds.tags[tag] += delta; ds.tags[tag] <= 0 {
+			delete(ds.tags, tag)
+		}
+	}
 }
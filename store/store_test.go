@@ -1,8 +1,12 @@
 package store
 
 import (
+	"errors"
+	"fmt"
 	"reflect"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/toversus/tbdist/model"
 )
@@ -10,7 +14,7 @@ import (
 var getTasksTests = []struct {
 	name   string
 	ds     *Datastore
-	status string
+	status model.Status
 	expect model.Tasks
 	err    error
 }{
@@ -62,12 +66,11 @@ var getTasksTests = []struct {
 	},
 }
 
-var getTasksSortedByPriorityTests = []struct {
+var findTasksTests = []struct {
 	name   string
 	ds     *Datastore
-	status string
+	query  model.Query
 	expect model.Tasks
-	err    error
 }{
 	{
 		name: "should return pending tasks sorted by priority",
@@ -79,13 +82,164 @@ var getTasksSortedByPriorityTests = []struct {
 				{ID: 4, Title: "go shopping", Status: "PENDING", Priority: 2},
 			},
 		},
-		status: "PENDING",
+		query: model.Query{Status: "PENDING", Sort: []model.SortKey{{Field: "priority"}}},
 		expect: model.Tasks{
 			{ID: 4, Title: "go shopping", Status: "PENDING", Priority: 2},
 			{ID: 2, Title: "withdraw my money", Status: "PENDING", Priority: 3},
 			{ID: 1, Title: "go to school", Status: "PENDING", Priority: 7},
 		},
 	},
+	{
+		name: "should return every task sorted by descending priority then title",
+		ds: &Datastore{
+			tasks: model.Tasks{
+				{ID: 1, Title: "go to school", Status: "DONE", Priority: 3},
+				{ID: 2, Title: "withdraw my money", Status: "PENDING", Priority: 3},
+				{ID: 3, Title: "play piano", Status: "DOING", Priority: 5},
+				{ID: 4, Title: "go shopping", Status: "PENDING", Priority: 3},
+			},
+		},
+		query: model.Query{Sort: []model.SortKey{{Field: "priority", Desc: true}, {Field: "title"}}},
+		expect: model.Tasks{
+			{ID: 3, Title: "play piano", Status: "DOING", Priority: 5},
+			{ID: 4, Title: "go shopping", Status: "PENDING", Priority: 3},
+			{ID: 1, Title: "go to school", Status: "DONE", Priority: 3},
+			{ID: 2, Title: "withdraw my money", Status: "PENDING", Priority: 3},
+		},
+	},
+	{
+		name: "should keep the stored order without sort keys",
+		ds: &Datastore{
+			tasks: model.Tasks{
+				{ID: 2, Title: "withdraw my money", Status: "DOING", Priority: 3},
+				{ID: 1, Title: "go to school", Status: "DOING", Priority: 1},
+			},
+		},
+		query: model.Query{Status: "DOING"},
+		expect: model.Tasks{
+			{ID: 2, Title: "withdraw my money", Status: "DOING", Priority: 3},
+			{ID: 1, Title: "go to school", Status: "DOING", Priority: 1},
+		},
+	},
+	{
+		name: "should return tasks with every included tag and no excluded tag",
+		ds: &Datastore{
+			tasks: model.Tasks{
+				{ID: 1, Title: "fix login", Status: "DOING", Priority: 1, Tags: []string{"api", "backend"}},
+				{ID: 2, Title: "fix cache", Status: "DOING", Priority: 1, Tags: []string{"backend", "blocked"}},
+				{ID: 3, Title: "fix button", Status: "DOING", Priority: 1, Tags: []string{"frontend"}},
+				{ID: 4, Title: "fix queue", Status: "DOING", Priority: 1, Tags: []string{"backend"}},
+			},
+		},
+		query: model.Query{Tags: []string{"backend"}, NotTags: []string{"blocked"}},
+		expect: model.Tasks{
+			{ID: 1, Title: "fix login", Status: "DOING", Priority: 1, Tags: []string{"api", "backend"}},
+			{ID: 4, Title: "fix queue", Status: "DOING", Priority: 1, Tags: []string{"backend"}},
+		},
+	},
+	{
+		name: "should return pending tasks whose blockers are all done",
+		ds: &Datastore{
+			tasks: model.Tasks{
+				{ID: 1, Title: "design", Status: "DONE", Priority: 1},
+				{ID: 2, Title: "review", Status: "DOING", Priority: 1},
+				{ID: 3, Title: "build", Status: "PENDING", Priority: 1, BlockedBy: []int{1}},
+				{ID: 4, Title: "ship", Status: "PENDING", Priority: 1, BlockedBy: []int{1, 2}},
+				{ID: 5, Title: "announce", Status: "PENDING", Priority: 1},
+			},
+		},
+		query: model.Query{Ready: true},
+		expect: model.Tasks{
+			{ID: 3, Title: "build", Status: "PENDING", Priority: 1, BlockedBy: []int{1}},
+			{ID: 5, Title: "announce", Status: "PENDING", Priority: 1},
+		},
+	},
+	{
+		name: "should return the tasks assigned to the subject",
+		ds: &Datastore{
+			tasks: model.Tasks{
+				{ID: 1, Title: "design", Status: "DONE", Priority: 1, Assignee: "alice"},
+				{ID: 2, Title: "review", Status: "DOING", Priority: 1, Assignee: "bob"},
+				{ID: 3, Title: "build", Status: "PENDING", Priority: 1},
+			},
+		},
+		query: model.Query{Assignee: "alice"},
+		expect: model.Tasks{
+			{ID: 1, Title: "design", Status: "DONE", Priority: 1, Assignee: "alice"},
+		},
+	},
+}
+
+func date(day int) *time.Time {
+	t := time.Date(2026, 10, day, 9, 0, 0, 0, time.UTC)
+	return &t
+}
+
+var dueTasks = model.Tasks{
+	{ID: 1, Title: "go to school", Status: "PENDING", Priority: 1, Due: date(19)},
+	{ID: 2, Title: "withdraw my money", Status: "DONE", Priority: 3, Due: date(10)},
+	{ID: 3, Title: "play piano", Status: "DOING", Priority: 5, Due: date(12)},
+	{ID: 4, Title: "go shopping", Status: "PENDING", Priority: 7},
+	{ID: 5, Title: "pay the rent", Status: "PENDING", Priority: 9, Due: date(11)},
+	{ID: 6, Title: "renew my passport", Status: "PENDING", Priority: 2, Due: date(25)},
+}
+
+var dueTasksTests = []struct {
+	name   string
+	find   func(ds *Datastore) model.Tasks
+	expect model.Tasks
+}{
+	{
+		name: "should return open overdue tasks, the most overdue first",
+		find: func(ds *Datastore) model.Tasks {
+			return ds.GetOverdueTasks(*date(18))
+		},
+		expect: model.Tasks{
+			{ID: 5, Title: "pay the rent", Status: "PENDING", Priority: 9, Due: date(11)},
+			{ID: 3, Title: "play piano", Status: "DOING", Priority: 5, Due: date(12)},
+		},
+	},
+	{
+		name: "should return open tasks due within the window",
+		find: func(ds *Datastore) model.Tasks {
+			return ds.GetTasksDueWithin(*date(11), 9*24*time.Hour)
+		},
+		expect: model.Tasks{
+			{ID: 5, Title: "pay the rent", Status: "PENDING", Priority: 9, Due: date(11)},
+			{ID: 3, Title: "play piano", Status: "DOING", Priority: 5, Due: date(12)},
+			{ID: 1, Title: "go to school", Status: "PENDING", Priority: 1, Due: date(19)},
+		},
+	},
+}
+
+var getTaskTests = []struct {
+	name   string
+	ds     *Datastore
+	id     int
+	expect model.Task
+	err    error
+}{
+	{
+		name: "should return the task with the given ID",
+		ds: &Datastore{
+			tasks: model.Tasks{
+				{ID: 1, Title: "go to school", Status: "DONE", Priority: 1},
+				{ID: 2, Title: "withdraw my money", Status: "PENDING", Priority: 3},
+			},
+		},
+		id:     2,
+		expect: model.Task{ID: 2, Title: "withdraw my money", Status: "PENDING", Priority: 3},
+	},
+	{
+		name: "should return an error when task ID does not exist",
+		ds: &Datastore{
+			tasks: model.Tasks{
+				{ID: 1, Title: "go to school", Status: "DONE", Priority: 1},
+			},
+		},
+		id:  2,
+		err: ErrTaskNotFound,
+	},
 }
 
 var saveTaskTests = []struct {
@@ -100,20 +254,45 @@ var saveTaskTests = []struct {
 		ds:   &Datastore{},
 		task: model.Task{Title: "withdraw my money", Status: "DOING", Priority: 1},
 		expect: model.Tasks{
-			{ID: 1, Title: "withdraw my money", Status: "DOING", Priority: 1},
+			{ID: 1, Title: "withdraw my money", Status: "DOING", Priority: 1, Version: 1},
 		},
 	},
 	{
 		name: "should update the existing task in the datastore",
 		ds: &Datastore{
 			tasks: []model.Task{
-				{ID: 1, Title: "withdraw my money", Status: "DOING", Priority: 9},
+				{ID: 1, Title: "withdraw my money", Status: "DOING", Priority: 9, Version: 1},
 			},
 		},
 		task: model.Task{ID: 1, Title: "withdraw my money", Status: "DONE", Priority: 9},
 		expect: model.Tasks{
-			{ID: 1, Title: "withdraw my money", Status: "DONE", Priority: 9},
+			{ID: 1, Title: "withdraw my money", Status: "DONE", Priority: 9, Version: 2},
+		},
+	},
+	{
+		name: "should update the existing task when its version matches",
+		ds: &Datastore{
+			tasks: []model.Task{
+				{ID: 1, Title: "withdraw my money", Status: "DOING", Priority: 9, Version: 4},
+			},
+		},
+		task: model.Task{ID: 1, Title: "withdraw my money", Status: "DONE", Priority: 9, Version: 4},
+		expect: model.Tasks{
+			{ID: 1, Title: "withdraw my money", Status: "DONE", Priority: 9, Version: 5},
+		},
+	},
+	{
+		name: "should return an error when the version does not match",
+		ds: &Datastore{
+			tasks: []model.Task{
+				{ID: 1, Title: "withdraw my money", Status: "DOING", Priority: 9, Version: 4},
+			},
+		},
+		task: model.Task{ID: 1, Title: "withdraw my money", Status: "DONE", Priority: 9, Version: 3},
+		expect: model.Tasks{
+			{ID: 1, Title: "withdraw my money", Status: "DOING", Priority: 9, Version: 4},
 		},
+		err: ErrVersionMismatch,
 	},
 	{
 		name: "should return an error when task ID does not exist",
@@ -121,6 +300,206 @@ var saveTaskTests = []struct {
 		task: model.Task{ID: 1, Title: "withdraw my money", Status: "DONE", Priority: 5},
 		err:  ErrTaskNotFound,
 	},
+	{
+		name: "should save a new task under its parent",
+		ds: &Datastore{
+			tasks:  model.Tasks{{ID: 1, Title: "release", Status: "DOING", Priority: 1, Version: 1}},
+			lastID: 1,
+		},
+		task: model.Task{Title: "write notes", Status: "PENDING", Priority: 1, Parent: 1},
+		expect: model.Tasks{
+			{ID: 1, Title: "release", Status: "DOING", Priority: 1, Version: 1},
+			{ID: 2, Title: "write notes", Status: "PENDING", Priority: 1, Parent: 1, Version: 1},
+		},
+	},
+	{
+		name: "should return an error when the parent does not exist",
+		ds: &Datastore{
+			tasks:  model.Tasks{{ID: 1, Title: "release", Status: "DOING", Priority: 1, Version: 1}},
+			lastID: 1,
+		},
+		task: model.Task{Title: "write notes", Status: "PENDING", Priority: 1, Parent: 3},
+		expect: model.Tasks{
+			{ID: 1, Title: "release", Status: "DOING", Priority: 1, Version: 1},
+		},
+		err: ErrConflict,
+	},
+	{
+		name: "should return an error when the task would be its own ancestor",
+		ds: &Datastore{
+			tasks: model.Tasks{
+				{ID: 1, Title: "release", Status: "DOING", Priority: 1, Version: 1},
+				{ID: 2, Title: "write notes", Status: "PENDING", Priority: 1, Parent: 1, Version: 1},
+				{ID: 3, Title: "list changes", Status: "PENDING", Priority: 1, Parent: 2, Version: 1},
+			},
+			lastID: 3,
+		},
+		task: model.Task{ID: 1, Title: "release", Status: "DOING", Priority: 1, Parent: 3},
+		expect: model.Tasks{
+			{ID: 1, Title: "release", Status: "DOING", Priority: 1, Version: 1},
+			{ID: 2, Title: "write notes", Status: "PENDING", Priority: 1, Parent: 1, Version: 1},
+			{ID: 3, Title: "list changes", Status: "PENDING", Priority: 1, Parent: 2, Version: 1},
+		},
+		err: ErrConflict,
+	},
+	{
+		name: "should save the blockers of the task as a sorted set",
+		ds: &Datastore{
+			tasks: model.Tasks{
+				{ID: 1, Title: "design", Status: "DONE", Priority: 1, Version: 1},
+				{ID: 2, Title: "review", Status: "DOING", Priority: 1, Version: 1},
+			},
+			lastID: 2,
+		},
+		task: model.Task{Title: "ship", Status: "PENDING", Priority: 1, BlockedBy: []int{2, 1, 2}},
+		expect: model.Tasks{
+			{ID: 1, Title: "design", Status: "DONE", Priority: 1, Version: 1},
+			{ID: 2, Title: "review", Status: "DOING", Priority: 1, Version: 1},
+			{ID: 3, Title: "ship", Status: "PENDING", Priority: 1, BlockedBy: []int{1, 2}, Version: 1},
+		},
+	},
+	{
+		name: "should return an error when a blocker does not exist",
+		ds: &Datastore{
+			tasks:  model.Tasks{{ID: 1, Title: "design", Status: "DONE", Priority: 1, Version: 1}},
+			lastID: 1,
+		},
+		task: model.Task{Title: "ship", Status: "PENDING", Priority: 1, BlockedBy: []int{1, 4}},
+		expect: model.Tasks{
+			{ID: 1, Title: "design", Status: "DONE", Priority: 1, Version: 1},
+		},
+		err: ErrConflict,
+	},
+	{
+		name: "should return an error when the blockers would create a cycle",
+		ds: &Datastore{
+			tasks: model.Tasks{
+				{ID: 1, Title: "design", Status: "PENDING", Priority: 1, Version: 1},
+				{ID: 2, Title: "build", Status: "PENDING", Priority: 1, BlockedBy: []int{1}, Version: 1},
+				{ID: 3, Title: "ship", Status: "PENDING", Priority: 1, BlockedBy: []int{2}, Version: 1},
+			},
+			lastID: 3,
+		},
+		task: model.Task{ID: 1, Title: "design", Status: "PENDING", Priority: 1, BlockedBy: []int{3}},
+		expect: model.Tasks{
+			{ID: 1, Title: "design", Status: "PENDING", Priority: 1, Version: 1},
+			{ID: 2, Title: "build", Status: "PENDING", Priority: 1, BlockedBy: []int{1}, Version: 1},
+			{ID: 3, Title: "ship", Status: "PENDING", Priority: 1, BlockedBy: []int{2}, Version: 1},
+		},
+		err: ErrConflict,
+	},
+	{
+		name: "should keep the creator of the existing task",
+		ds: &Datastore{
+			tasks: model.Tasks{{ID: 1, Title: "release", Status: "DOING", Priority: 1, Creator: "alice", Assignee: "alice", Version: 1}},
+		},
+		task: model.Task{ID: 1, Title: "release", Status: "DOING", Priority: 1, Creator: "bob", Assignee: "bob"},
+		expect: model.Tasks{
+			{ID: 1, Title: "release", Status: "DOING", Priority: 1, Creator: "alice", Assignee: "bob", Version: 2},
+		},
+	},
+	{
+		name: "should return an error when the task would be its own parent",
+		ds: &Datastore{
+			tasks: model.Tasks{{ID: 1, Title: "release", Status: "DOING", Priority: 1, Version: 1}},
+		},
+		task: model.Task{ID: 1, Title: "release", Status: "DOING", Priority: 1, Parent: 1},
+		expect: model.Tasks{
+			{ID: 1, Title: "release", Status: "DOING", Priority: 1, Version: 1},
+		},
+		err: ErrConflict,
+	},
+}
+
+var deleteTaskTests = []struct {
+	name    string
+	ds      *Datastore
+	id      int
+	version int
+	expect  model.Tasks
+	err     error
+}{
+	{
+		name: "should delete the task from the datastore",
+		ds: &Datastore{
+			tasks: model.Tasks{
+				{ID: 1, Title: "withdraw my money", Status: "DOING", Priority: 1},
+				{ID: 2, Title: "go shopping", Status: "PENDING", Priority: 3},
+			},
+		},
+		id: 1,
+		expect: model.Tasks{
+			{ID: 2, Title: "go shopping", Status: "PENDING", Priority: 3},
+		},
+	},
+	{
+		name: "should return an error when task ID does not exist",
+		ds: &Datastore{
+			tasks: model.Tasks{
+				{ID: 1, Title: "withdraw my money", Status: "DOING", Priority: 1},
+			},
+		},
+		id: 2,
+		expect: model.Tasks{
+			{ID: 1, Title: "withdraw my money", Status: "DOING", Priority: 1},
+		},
+		err: ErrTaskNotFound,
+	},
+	{
+		name: "should delete the task when its version matches",
+		ds: &Datastore{
+			tasks: model.Tasks{
+				{ID: 1, Title: "withdraw my money", Status: "DOING", Priority: 1, Version: 3},
+			},
+		},
+		id:      1,
+		version: 3,
+		expect:  model.Tasks{},
+	},
+	{
+		name: "should return an error when the version does not match",
+		ds: &Datastore{
+			tasks: model.Tasks{
+				{ID: 1, Title: "withdraw my money", Status: "DOING", Priority: 1, Version: 3},
+			},
+		},
+		id:      1,
+		version: 2,
+		expect: model.Tasks{
+			{ID: 1, Title: "withdraw my money", Status: "DOING", Priority: 1, Version: 3},
+		},
+		err: ErrVersionMismatch,
+	},
+	{
+		name: "should return an error when the task has children",
+		ds: &Datastore{
+			tasks: model.Tasks{
+				{ID: 1, Title: "release", Status: "DOING", Priority: 1},
+				{ID: 2, Title: "write notes", Status: "PENDING", Priority: 1, Parent: 1},
+			},
+		},
+		id: 1,
+		expect: model.Tasks{
+			{ID: 1, Title: "release", Status: "DOING", Priority: 1},
+			{ID: 2, Title: "write notes", Status: "PENDING", Priority: 1, Parent: 1},
+		},
+		err: ErrConflict,
+	},
+	{
+		name: "should return an error when the task blocks another task",
+		ds: &Datastore{
+			tasks: model.Tasks{
+				{ID: 1, Title: "design", Status: "DONE", Priority: 1},
+				{ID: 2, Title: "build", Status: "PENDING", Priority: 1, BlockedBy: []int{1}},
+			},
+		},
+		id: 1,
+		expect: model.Tasks{
+			{ID: 1, Title: "design", Status: "DONE", Priority: 1},
+			{ID: 2, Title: "build", Status: "PENDING", Priority: 1, BlockedBy: []int{1}},
+		},
+		err: ErrConflict,
+	},
 }
 
 func TestGetTasks(t *testing.T) {
@@ -129,20 +508,46 @@ func TestGetTasks(t *testing.T) {
 	for _, testcase := range getTasksTests {
 		t.Log(testcase.name)
 		t.Log(testcase.status)
-		if !reflect.DeepEqual(testcase.ds.getTasks(testcase.status), testcase.expect) {
+		if !reflect.DeepEqual(testcase.ds.GetTasksByStatus(testcase.status), testcase.expect) {
 			t.Errorf("=> Got %#v expected %#v", testcase.ds.tasks, testcase.expect)
 		}
 	}
 }
 
-func TestGetTasksSortedByPriority(t *testing.T) {
-	t.Log("getting tasks sorted by priority...")
+func TestFindTasks(t *testing.T) {
+	t.Log("finding tasks...")
 
-	for _, testcase := range getTasksSortedByPriorityTests {
+	for _, testcase := range findTasksTests {
 		t.Log(testcase.name)
-		t.Log(testcase.status)
-		if !reflect.DeepEqual(testcase.ds.getTasksSortedByPriority(testcase.status), testcase.expect) {
-			t.Errorf("=> Got %#v,\n => expected %#v", testcase.ds.tasks, testcase.expect)
+		if result := testcase.ds.FindTasks(testcase.query); !reflect.DeepEqual(result, testcase.expect) {
+			t.Errorf("=> Got %#v,\n => expected %#v", result, testcase.expect)
+		}
+	}
+}
+
+func TestDueTasks(t *testing.T) {
+	t.Log("getting tasks by deadline...")
+
+	for _, testcase := range dueTasksTests {
+		t.Log(testcase.name)
+		ds := &Datastore{tasks: dueTasks}
+		if result := testcase.find(ds); !reflect.DeepEqual(result, testcase.expect) {
+			t.Errorf("=> Got %#v,\n => expected %#v", result, testcase.expect)
+		}
+	}
+}
+
+func TestGetTask(t *testing.T) {
+	t.Log("getting task...")
+
+	for _, testcase := range getTaskTests {
+		t.Log(testcase.name)
+		task, err := testcase.ds.GetTask(testcase.id)
+		if err != testcase.err {
+			t.Errorf("=> Got %v expected %v", err, testcase.err)
+		}
+		if !reflect.DeepEqual(task, testcase.expect) {
+			t.Errorf("=> Got %#v expected %#v", task, testcase.expect)
 		}
 	}
 }
@@ -153,10 +558,297 @@ func TestSaveTask(t *testing.T) {
 	for _, testcase := range saveTaskTests {
 		t.Log(testcase.name)
 		t.Log(testcase.task.Status)
-		testcase.ds.SaveTask(testcase.task)
+		task, err := testcase.ds.SaveTask(testcase.task)
 		t.Log(testcase.task.Status)
+		if !errors.Is(err, testcase.err) {
+			t.Errorf("=> Got %v expected %v", err, testcase.err)
+		}
+		if !reflect.DeepEqual(testcase.ds.tasks, testcase.expect) {
+			t.Errorf("=> Got %#v expected %#v", testcase.ds.tasks, testcase.expect)
+		}
+		if err == nil && !reflect.DeepEqual(task, testcase.expect[len(testcase.expect)-1]) {
+			t.Errorf("=> Got %#v expected the stored task", task)
+		}
+	}
+}
+
+func TestDeleteTask(t *testing.T) {
+	t.Log("deleting task...")
+
+	for _, testcase := range deleteTaskTests {
+		t.Log(testcase.name)
+		if err := testcase.ds.DeleteTask(testcase.id, testcase.version); !errors.Is(err, testcase.err) {
+			t.Errorf("=> Got %v expected %v", err, testcase.err)
+		}
 		if !reflect.DeepEqual(testcase.ds.tasks, testcase.expect) {
 			t.Errorf("=> Got %#v expected %#v", testcase.ds.tasks, testcase.expect)
 		}
 	}
 }
+
+func TestGetTags(t *testing.T) {
+	t.Log("counting tags...")
+
+	ds := &Datastore{}
+	ds.SaveTask(model.Task{Title: "fix login", Status: "DOING", Priority: 1, Tags: []string{"backend", "api", "backend"}})
+	ds.SaveTask(model.Task{Title: "fix cache", Status: "DOING", Priority: 1, Tags: []string{"backend", "blocked"}})
+	ds.SaveTask(model.Task{Title: "fix button", Status: "DOING", Priority: 1, Tags: []string{"frontend"}})
+	ds.SaveTask(model.Task{ID: 2, Title: "fix cache", Status: "DOING", Priority: 1, Tags: []string{"backend"}})
+	ds.DeleteTask(3, 0)
+
+	if task, _ := ds.GetTask(1); !reflect.DeepEqual(task.Tags, []string{"api", "backend"}) {
+		t.Errorf("=> Got %v expected [api backend]", task.Tags)
+	}
+	if tags, expect := ds.GetTags(), map[string]int{"api": 1, "backend": 2}; !reflect.DeepEqual(tags, expect) {
+		t.Errorf("=> Got %v expected %v", tags, expect)
+	}
+}
+
+var recurrenceTests = []struct {
+	name   string
+	due    time.Time
+	rule   model.Recurrence
+	expect *time.Time // deadline of the next occurrence, nil when there is none
+	count  int
+}{
+	{
+		name:   "should repeat a daily task every other day",
+		due:    *date(19),
+		rule:   model.Recurrence{Freq: model.Daily, Interval: 2},
+		expect: date(21),
+	},
+	{
+		name:   "should repeat a weekly task on the next day of the week",
+		due:    *date(19), // Monday
+		rule:   model.Recurrence{Freq: model.Weekly, ByDay: []string{"MO", "TH"}},
+		expect: date(22),
+	},
+	{
+		name:   "should repeat a weekly task on the first day of the next week of the interval",
+		due:    *date(22), // Thursday
+		rule:   model.Recurrence{Freq: model.Weekly, Interval: 2, ByDay: []string{"MO", "TH"}},
+		expect: timePtr(time.Date(2026, 11, 2, 9, 0, 0, 0, time.UTC)),
+	},
+	{
+		name:   "should repeat a weekly task from the end of the week",
+		due:    *date(25), // Sunday
+		rule:   model.Recurrence{Freq: model.Weekly, Interval: 3, ByDay: []string{"TH"}},
+		expect: timePtr(time.Date(2026, 11, 12, 9, 0, 0, 0, time.UTC)),
+	},
+	{
+		name:   "should repeat a weekly task with the largest interval",
+		due:    *date(19), // Monday
+		rule:   model.Recurrence{Freq: model.Weekly, Interval: model.MaxInterval, ByDay: []string{"MO"}},
+		expect: timePtr(date(19).AddDate(0, 0, 7*model.MaxInterval)),
+	},
+	{
+		name:   "should repeat a weekly task without day on the same day",
+		due:    *date(22),
+		rule:   model.Recurrence{Freq: model.Weekly},
+		expect: date(29),
+	},
+	{
+		name:   "should skip the months too short for a monthly task",
+		due:    time.Date(2026, 1, 31, 9, 0, 0, 0, time.UTC),
+		rule:   model.Recurrence{Freq: model.Monthly},
+		expect: timePtr(time.Date(2026, 3, 31, 9, 0, 0, 0, time.UTC)),
+	},
+	{
+		name:   "should count down the occurrences",
+		due:    *date(19),
+		rule:   model.Recurrence{Freq: model.Daily, Count: 3},
+		expect: date(20),
+		count:  2,
+	},
+	{
+		name: "should stop after the last occurrence",
+		due:  *date(19),
+		rule: model.Recurrence{Freq: model.Daily, Count: 1},
+	},
+	{
+		name: "should stop after the until date",
+		due:  *date(19),
+		rule: model.Recurrence{Freq: model.Weekly, Until: date(25)},
+	},
+}
+
+func timePtr(t time.Time) *time.Time {
+	return &t
+}
+
+func TestRecurringTasks(t *testing.T) {
+	t.Log("completing recurring tasks...")
+
+	for _, testcase := range recurrenceTests {
+		t.Log(testcase.name)
+
+		ds := &Datastore{}
+		rule := testcase.rule
+		ds.SaveTask(model.Task{Title: "rotate on-call", Status: "DOING", Priority: 1, Due: &testcase.due, Recurrence: &rule,
+			Creator: "alice", Assignee: "bob"})
+
+		done, err := ds.SaveTask(model.Task{ID: 1, Title: "rotate on-call", Status: "DONE", Priority: 1, Due: &testcase.due, Recurrence: &rule,
+			Assignee: "bob"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if testcase.expect == nil {
+			if done.Next != 0 || len(ds.tasks) != 1 {
+				t.Errorf("=> Got next occurrence %d expected none", done.Next)
+			}
+			continue
+		}
+
+		next, err := ds.GetTask(done.Next)
+		if err != nil || done.Next != 2 {
+			t.Fatalf("=> Got next occurrence %d, %v expected 2", done.Next, err)
+		}
+		if !next.Due.Equal(*testcase.expect) {
+			t.Errorf("=> Got due %v expected %v", next.Due, testcase.expect)
+		}
+		if next.Status != model.StatusPending || next.Previous != 1 || next.Recurrence.Count != testcase.count {
+			t.Errorf("=> Got %#v expected a pending occurrence following task 1", next)
+		}
+		if next.Creator != "alice" || next.Assignee != "bob" {
+			t.Errorf("=> Got creator %q and assignee %q expected alice and bob", next.Creator, next.Assignee)
+		}
+
+		// Reopening and completing the task again does not repeat it twice
+		ds.SaveTask(model.Task{ID: 1, Title: "rotate on-call", Status: "PENDING", Priority: 1, Due: &testcase.due, Recurrence: &rule})
+		ds.SaveTask(model.Task{ID: 1, Title: "rotate on-call", Status: "DONE", Priority: 1, Due: &testcase.due, Recurrence: &rule})
+		if len(ds.tasks) != 2 {
+			t.Errorf("=> Got %d tasks expected 2", len(ds.tasks))
+		}
+	}
+}
+
+func TestSaveTasks(t *testing.T) {
+	t.Log("saving tasks all together...")
+
+	ds := &Datastore{}
+	due := date(19)
+	rule := model.Recurrence{Freq: model.Daily}
+	ds.SaveTask(model.Task{Title: "rotate on-call", Status: "DOING", Priority: 1, Due: due, Recurrence: &rule})
+	ds.SaveTask(model.Task{Title: "fix login", Status: "PENDING", Priority: 2})
+	before := ds.FindTasks(model.Query{})
+
+	// The last task fails, the completed one and the new one are undone
+	_, err := ds.SaveTasks(model.Tasks{
+		{ID: 1, Title: "rotate on-call", Status: "DONE", Priority: 1, Due: due, Recurrence: &rule},
+		{Title: "fix logout", Status: "PENDING", Priority: 3},
+		{ID: 2, Title: "fix login", Status: "PENDING", Priority: 2, Parent: 9},
+	})
+	if !errors.Is(err, ErrConflict) {
+		t.Errorf("=> Got %v expected %v", err, ErrConflict)
+	}
+	if tasks := ds.FindTasks(model.Query{}); !reflect.DeepEqual(tasks, before) {
+		t.Errorf("=> Got %#v expected %#v", tasks, before)
+	}
+
+	saved, err := ds.SaveTasks(model.Tasks{
+		{ID: 2, Title: "fix login", Status: "DOING", Priority: 2},
+		{Title: "fix logout", Status: "PENDING", Priority: 3, BlockedBy: []int{2}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The IDs taken by the saves undone are not reused
+	expect := model.Tasks{
+		{ID: 2, Title: "fix login", Status: "DOING", Priority: 2, Version: 2},
+		{ID: 5, Title: "fix logout", Status: "PENDING", Priority: 3, BlockedBy: []int{2}, Version: 1},
+	}
+	if !reflect.DeepEqual(saved, expect) {
+		t.Errorf("=> Got %#v expected %#v", saved, expect)
+	}
+}
+
+// failingJournal fails the put of the given number, counting from 1
+type failingJournal struct {
+	puts   int
+	failAt int
+}
+
+func (j *failingJournal) put(task model.Task) error {
+	j.puts++
+	if j.puts == j.failAt {
+		return errors.New("disk full")
+	}
+	return nil
+}
+
+func (j *failingJournal) remove(id int) error {
+	return nil
+}
+
+func TestRecurringTaskFailedSave(t *testing.T) {
+	t.Log("failing to complete a recurring task...")
+
+	// The completion stores the next occurrence then the completed task
+	ds := &Datastore{journal: &failingJournal{failAt: 3}}
+	rule := model.Recurrence{Freq: model.Daily}
+	ds.SaveTask(model.Task{Title: "rotate on-call", Status: "DOING", Priority: 1, Due: date(19), Recurrence: &rule})
+
+	if _, err := ds.SaveTask(model.Task{ID: 1, Title: "rotate on-call", Status: "DONE", Priority: 1, Due: date(19), Recurrence: &rule}); err == nil {
+		t.Fatalf("=> Got no error expected the save to fail")
+	}
+	if len(ds.tasks) != 1 || ds.tasks[0].Status != "DOING" || ds.tasks[0].Next != 0 {
+		t.Errorf("=> Got %#v expected the task left as it was", ds.tasks)
+	}
+
+	done, err := ds.SaveTask(model.Task{ID: 1, Title: "rotate on-call", Status: "DONE", Priority: 1, Due: date(19), Recurrence: &rule})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ds.tasks) != 2 || done.Next != ds.tasks[1].ID {
+		t.Errorf("=> Got %#v expected a single occurrence linked to the task", ds.tasks)
+	}
+}
+
+// TestConcurrentAccess is meant to be run with -race
+func TestConcurrentAccess(t *testing.T) {
+	t.Log("accessing the datastore concurrently...")
+
+	const workers, iterations = 8, 100
+	ds := &Datastore{}
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(2)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < iterations; i++ {
+				task := model.Task{Title: fmt.Sprintf("task %d-%d", w, i), Status: "PENDING", Priority: 1}
+				if _, err := ds.SaveTask(task); err != nil {
+					t.Errorf("=> Got %v expected no error", err)
+				}
+				task.ID = 1
+				task.Status = "DOING"
+				ds.SaveTask(task)
+			}
+		}(w)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < iterations; i++ {
+				ds.GetTasksByStatus(model.StatusPending)
+				ds.GetTasksByStatus(model.StatusDoing)
+				ds.GetTasksByStatus(model.StatusDone)
+				ds.FindTasks(model.Query{Sort: []model.SortKey{{Field: "priority", Desc: true}}})
+				ds.GetTask(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	tasks := ds.FindTasks(model.Query{})
+	if len(tasks) != workers*iterations {
+		t.Fatalf("=> Got %d tasks expected %d", len(tasks), workers*iterations)
+	}
+	ids := make(map[int]bool)
+	for _, task := range tasks {
+		if ids[task.ID] {
+			t.Errorf("=> Got duplicated ID %d", task.ID)
+		}
+		ids[task.ID] = true
+	}
+}
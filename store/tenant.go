@@ -0,0 +1,88 @@
+package store
+
+import (
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/toversus/tbdist/model"
+)
+
+// Tenants partitions the tasks and the projects per tenant, each tenant
+// gets a datastore and a registry of projects of its own on first use.
+// It is safe for concurrent use
+type Tenants struct {
+	mu       sync.Mutex // mu guards tenants
+	tenants  map[string]*tenant
+	dir      string        // dir persists the tenants, empty to keep them in memory
+	interval time.Duration // interval between two snapshots of a datastore
+}
+
+type tenant struct {
+	tasks    *Datastore
+	file     *FileStore // file persists the tasks, nil when they are kept in memory
+	projects *Projects
+}
+
+// NewTenants returns tenants whose data is kept in memory
+func NewTenants() *Tenants {
+	return &Tenants{tenants: make(map[string]*tenant)}
+}
+
+// OpenFileTenants returns tenants whose data is persisted in a
+// subdirectory of dir named after the tenant ID
+func OpenFileTenants(dir string, interval time.Duration) *Tenants {
+	return &Tenants{tenants: make(map[string]*tenant), dir: dir, interval: interval}
+}
+
+// Tenant returns the datastore and the projects of the tenant. Tenant IDs
+// follow the rules of project IDs as they name directories
+func (ts *Tenants) Tenant(id string) (*Datastore, *Projects, error) {
+	if !model.ValidProjectID(id) {
+		return nil, nil, ErrInvalidProject
+	}
+
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	if t, ok := ts.tenants[id]; ok {
+		return t.tasks, t.projects, nil
+	}
+
+	t := &tenant{tasks: &Datastore{}, projects: NewProjects()}
+	if ts.dir != "" {
+		dir := filepath.Join(ts.dir, id)
+		fs, err := OpenFileStore(dir, ts.interval)
+		if err != nil {
+			return nil, nil, err
+		}
+		projects, err := OpenFileProjects(filepath.Join(dir, "projects"), ts.interval)
+		if err != nil {
+			fs.Close()
+			return nil, nil, err
+		}
+		t.tasks, t.file, t.projects = fs.Datastore, fs, projects
+	}
+
+	ts.tenants[id] = t
+	return t.tasks, t.projects, nil
+}
+
+// Close releases the files of the tenants
+func (ts *Tenants) Close() error {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	var err error
+	for _, t := range ts.tenants {
+		if t.file != nil {
+			if cerr := t.file.Close(); err == nil {
+				err = cerr
+			}
+		}
+		if cerr := t.projects.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
@@ -0,0 +1,50 @@
+package store
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/toversus/tbdist/model"
+)
+
+func TestTenants(t *testing.T) {
+	t.Log("partitioning tenants...")
+
+	dir := t.TempDir()
+	for _, ts := range []*Tenants{NewTenants(), OpenFileTenants(dir, 0)} {
+		a, aProjects, err := ts.Tenant("team-a")
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, bProjects, _ := ts.Tenant("team-b")
+
+		a.SaveTask(model.Task{Title: "go to school", Status: "PENDING", Priority: 1})
+		aProjects.SaveProject(model.Project{ID: "api", Name: "API"})
+
+		if tasks := b.FindTasks(model.Query{}); tasks != nil {
+			t.Errorf("=> Got %#v expected no task", tasks)
+		}
+		if projects := bProjects.GetProjects(); len(projects) != 0 {
+			t.Errorf("=> Got %#v expected no project", projects)
+		}
+		if again, _, _ := ts.Tenant("team-a"); again != a {
+			t.Errorf("=> Got another datastore for the same tenant")
+		}
+		if _, _, err := ts.Tenant("../team-a"); err != ErrInvalidProject {
+			t.Errorf("=> Got %v expected %v", err, ErrInvalidProject)
+		}
+		ts.Close()
+	}
+
+	// The data of the tenants is recovered from the data directory
+	ts := OpenFileTenants(dir, 0)
+	defer ts.Close()
+	a, aProjects, _ := ts.Tenant("team-a")
+	expect := model.Tasks{{ID: 1, Title: "go to school", Status: "PENDING", Priority: 1, Version: 1}}
+	if tasks := a.FindTasks(model.Query{}); !reflect.DeepEqual(tasks, expect) {
+		t.Errorf("=> Got %#v expected %#v", tasks, expect)
+	}
+	if projects := aProjects.GetProjects(); len(projects) != 1 {
+		t.Errorf("=> Got %#v expected the api project", projects)
+	}
+}